@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Outcome 请求结果
+type Outcome int
+
+const (
+	//成功，延迟计入统计
+	OutcomeSuccess Outcome = iota
+	//超时、过载等被下游拒绝，立即减小并发限额
+	OutcomeDropped
+	//与下游负载无关的失败，不计入统计
+	OutcomeIgnore
+)
+
+// 长期平均延迟的更新间隔
+const longRTTInterval = 64 * time.Millisecond
+
+// AdaptiveLimiter 自适应并发限流 AIMD(加性增、乘性减)
+// 以 RollingWindow 统计近期平均延迟，超过长期平均延迟的 Tolerance 倍或请求被拒绝时按 BackoffRatio 减小限额，
+// 否则在并发接近限额时每次成功加一，使限额贴近下游的实际处理能力。
+type AdaptiveLimiter struct {
+	//限额范围
+	MinLimit, MaxLimit int64
+	//延迟容忍倍数，默认2
+	Tolerance float64
+	//减小比例，默认0.9
+	BackoffRatio float64
+	mutex        sync.Mutex
+	limit        float64
+	inflight     int64
+	//长期平均延迟（指数移动平均），纳秒
+	longRTT    float64
+	lastUpdate time.Time
+	//近期延迟总和与样本数
+	latency, samples *RollingWindow
+	notify           chan struct{}
+}
+
+// NewAdaptiveLimiter 新建，initial 为初始限额
+func NewAdaptiveLimiter(initial, minLimit, maxLimit int64) *AdaptiveLimiter {
+	//2^4=16个窗口，每个窗口2^26约67ms，统计最近约0.5秒
+	return &AdaptiveLimiter{
+		MinLimit:     max(minLimit, 1),
+		MaxLimit:     max(maxLimit, minLimit, 1),
+		Tolerance:    2,
+		BackoffRatio: 0.9,
+		limit:        float64(min(max(initial, minLimit, 1), max(maxLimit, 1))),
+		latency:      NewRollingWindow(4, 8, 26),
+		samples:      NewRollingWindow(4, 8, 26),
+		notify:       make(chan struct{}, 1),
+	}
+}
+
+// AdaptiveToken 并发许可，用完须 Release 一次
+type AdaptiveToken struct {
+	limiter *AdaptiveLimiter
+	start   time.Time
+	once    sync.Once
+}
+
+// TryAcquire 获取许可，达到限额时返回false
+func (a *AdaptiveLimiter) TryAcquire() (*AdaptiveToken, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.inflight >= int64(a.limit) {
+		return nil, false
+	}
+	a.inflight++
+	return &AdaptiveToken{limiter: a, start: time.Now()}, true
+}
+
+// Acquire 获取许可，达到限额时等待，直到ctx结束
+func (a *AdaptiveLimiter) Acquire(ctx context.Context) (*AdaptiveToken, error) {
+	for {
+		if t, ok := a.TryAcquire(); ok {
+			return t, nil
+		}
+		select {
+		case <-a.notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Release 归还许可并报告结果，重复调用无效
+func (t *AdaptiveToken) Release(outcome Outcome) {
+	t.once.Do(func() {
+		t.limiter.release(time.Since(t.start), outcome)
+	})
+}
+
+func (a *AdaptiveLimiter) release(rtt time.Duration, outcome Outcome) {
+	a.mutex.Lock()
+	saturated := a.inflight*2 >= int64(a.limit)
+	a.inflight--
+	switch outcome {
+	case OutcomeDropped:
+		a.backoff()
+	case OutcomeSuccess:
+		a.latency.Add(int64(rtt))
+		a.samples.Add(1)
+		if a.longRTT == 0 {
+			a.longRTT = float64(rtt)
+		}
+		var short float64
+		if n := a.samples.Sum(); n > 0 {
+			short = float64(a.latency.Sum()) / float64(n)
+			//长期平均按时间而非样本更新，时间常数约3秒，远长于近期窗口
+			if now := time.Now(); now.Sub(a.lastUpdate) >= longRTTInterval {
+				a.longRTT = a.longRTT*0.98 + short*0.02
+				a.lastUpdate = now
+			}
+		}
+		if short > a.longRTT*a.Tolerance {
+			a.backoff()
+		} else if saturated {
+			a.limit = min(a.limit+1, float64(a.MaxLimit))
+		}
+	}
+	a.mutex.Unlock()
+	wake(a.notify)
+}
+
+// backoff 乘性减，需持有锁
+func (a *AdaptiveLimiter) backoff() {
+	a.limit = max(a.limit*a.BackoffRatio, float64(a.MinLimit))
+}
+
+// Limit 当前限额
+func (a *AdaptiveLimiter) Limit() int64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return int64(a.limit)
+}
+
+// Inflight 当前并发数
+func (a *AdaptiveLimiter) Inflight() int64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.inflight
+}
+
+// Do 获取许可后执行f，f 返回 context.DeadlineExceeded 时视为被拒绝，panic 时释放许可后继续抛出
+func (a *AdaptiveLimiter) Do(ctx context.Context, f func() error) error {
+	t, err := a.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	done := false
+	defer func() {
+		if !done {
+			t.Release(OutcomeIgnore)
+		}
+	}()
+	err = f()
+	done = true
+	switch {
+	case err == nil:
+		t.Release(OutcomeSuccess)
+	case errors.Is(err, context.DeadlineExceeded):
+		t.Release(OutcomeDropped)
+	default:
+		t.Release(OutcomeIgnore)
+	}
+	return err
+}
+
+// https://github.com/Netflix/concurrency-limits
+// https://github.com/platinummonkey/go-concurrency-limits
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiterAcquire(t *testing.T) {
+	a := NewAdaptiveLimiter(2, 1, 10)
+	t1, _ := a.TryAcquire()
+	t2, _ := a.TryAcquire()
+	if _, ok := a.TryAcquire(); ok || a.Inflight() != 2 {
+		t.Fatal(a.Inflight())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := a.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		t1.Release(OutcomeIgnore)
+		t1.Release(OutcomeIgnore)
+	}()
+	t3, err := a.Acquire(context.Background())
+	if err != nil || a.Inflight() != 2 {
+		t.Fatal(err, a.Inflight())
+	}
+	t2.Release(OutcomeIgnore)
+	t3.Release(OutcomeIgnore)
+	if a.Inflight() != 0 || a.Limit() != 2 {
+		t.Fatal(a.Inflight(), a.Limit())
+	}
+}
+
+func TestAdaptiveLimiterAIMD(t *testing.T) {
+	a := NewAdaptiveLimiter(4, 2, 8)
+	// 并发饱和且延迟稳定时加性增
+	for range 20 {
+		var tokens []*AdaptiveToken
+		for {
+			tk, ok := a.TryAcquire()
+			if !ok {
+				break
+			}
+			tokens = append(tokens, tk)
+		}
+		for _, tk := range tokens {
+			tk.Release(OutcomeSuccess)
+		}
+	}
+	if a.Limit() != 8 {
+		t.Fatal(a.Limit())
+	}
+	// 被拒绝时乘性减，不低于下限
+	for range 20 {
+		tk, _ := a.TryAcquire()
+		tk.Release(OutcomeDropped)
+	}
+	if a.Limit() != 2 {
+		t.Fatal(a.Limit())
+	}
+	err := a.Do(context.Background(), func() error { return context.DeadlineExceeded })
+	if !errors.Is(err, context.DeadlineExceeded) || a.Inflight() != 0 {
+		t.Fatal(err)
+	}
+}
+
+func TestAdaptiveLimiterLatency(t *testing.T) {
+	a := NewAdaptiveLimiter(8, 1, 8)
+	run := func(rtt time.Duration, d time.Duration) {
+		start := time.Now()
+		for time.Since(start) < d {
+			a.TryAcquire()
+			a.release(rtt, OutcomeSuccess)
+			time.Sleep(100 * time.Microsecond)
+		}
+	}
+	run(time.Millisecond, 300*time.Millisecond)
+	if a.Limit() != 8 {
+		t.Fatal(a.Limit())
+	}
+	// 延迟突增后减小限额
+	run(20*time.Millisecond, 300*time.Millisecond)
+	if a.Limit() != 1 {
+		t.Fatal(a.Limit())
+	}
+}
+
+func TestAdaptiveLimiterPanic(t *testing.T) {
+	a := NewAdaptiveLimiter(1, 1, 1)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic")
+			}
+		}()
+		a.Do(context.Background(), func() error { panic("do") })
+	}()
+	// 许可已释放
+	if a.Inflight() != 0 {
+		t.Fatal(a.Inflight())
+	}
+	if err := a.Do(context.Background(), func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// BreakerState 熔断器状态
+type BreakerState int32
+
+const (
+	//关闭，正常放行
+	StateClosed BreakerState = iota
+	//打开，全部拒绝
+	StateOpen
+	//半开，放行少量探测请求
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// ErrCircuitOpen 熔断器打开时拒绝请求
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// errCircuitPanic f 发生 panic 时计为失败
+var errCircuitPanic = errors.New("circuit breaker: panic")
+
+// CircuitBreaker 熔断器，以 RollingWindow 统计成功、失败、超时次数
+// 窗口内错误率（失败+超时）达到 ErrorRate 或连续失败达到 ConsecutiveFailures 时打开，
+// 打开 OpenTimeout 后进入半开，放行 HalfOpenRequests 个探测请求，全部成功则关闭，任一失败则重新打开。
+type CircuitBreaker struct {
+	//错误率阈值 0-1
+	ErrorRate float64
+	//窗口内请求数少于此值时不按错误率判断
+	MinRequests int64
+	//连续失败阈值，0 表示不启用
+	ConsecutiveFailures int64
+	//打开持续时间
+	OpenTimeout time.Duration
+	//半开状态的探测请求数
+	HalfOpenRequests int64
+	//状态变化回调，在锁外调用
+	OnStateChange func(from, to BreakerState)
+	mutex         sync.Mutex
+	state         BreakerState
+	//2^4=16个窗口，每个窗口2^27约134ms，统计最近约1秒
+	success, failure, timeout *RollingWindow
+	consecutive               int64
+	openedAt                  time.Time
+	probes, probeSuccess      int64
+	//状态切换时递增，旧代放行的请求结果只计入统计，不影响探测
+	generation uint64
+	//时钟，nil 为系统时钟
+	clock Clock
+}
+
+// NewCircuitBreaker 新建
+func NewCircuitBreaker(errorRate float64, minRequests int64, openTimeout time.Duration) *CircuitBreaker {
+	b := &CircuitBreaker{
+		ErrorRate:        errorRate,
+		MinRequests:      minRequests,
+		OpenTimeout:      openTimeout,
+		HalfOpenRequests: 1,
+	}
+	b.resetCounts()
+	return b
+}
+
+// SetClock 设置时钟，须在使用前设置
+func (b *CircuitBreaker) SetClock(c Clock) *CircuitBreaker {
+	b.mutex.Lock()
+	b.clock = c
+	b.success.SetClock(c)
+	b.failure.SetClock(c)
+	b.timeout.SetClock(c)
+	b.mutex.Unlock()
+	return b
+}
+
+func (b *CircuitBreaker) resetCounts() {
+	b.success = NewRollingWindow(4, 8, 27).SetClock(b.clock)
+	b.failure = NewRollingWindow(4, 8, 27).SetClock(b.clock)
+	b.timeout = NewRollingWindow(4, 8, 27).SetClock(b.clock)
+	b.consecutive = 0
+}
+
+// setState 切换状态，需持有锁，返回需在锁外执行的回调
+func (b *CircuitBreaker) setState(to BreakerState) func() {
+	from := b.state
+	if from == to {
+		return nil
+	}
+	b.state = to
+	b.generation++
+	switch to {
+	case StateOpen:
+		b.openedAt = clockOr(b.clock).Now()
+	case StateHalfOpen:
+		b.probes, b.probeSuccess = 0, 0
+	case StateClosed:
+		b.resetCounts()
+	}
+	if f := b.OnStateChange; f != nil {
+		return func() { f(from, to) }
+	}
+	return nil
+}
+
+// State 当前状态
+func (b *CircuitBreaker) State() BreakerState {
+	b.mutex.Lock()
+	notify := b.refresh()
+	state := b.state
+	b.mutex.Unlock()
+	if notify != nil {
+		notify()
+	}
+	return state
+}
+
+// refresh 打开超时后转为半开，需持有锁
+func (b *CircuitBreaker) refresh() func() {
+	if b.state == StateOpen && clockOr(b.clock).Now().Sub(b.openedAt) >= b.OpenTimeout {
+		return b.setState(StateHalfOpen)
+	}
+	return nil
+}
+
+// before 请求前检查是否放行，返回放行时的代
+func (b *CircuitBreaker) before() (uint64, error) {
+	b.mutex.Lock()
+	notify := b.refresh()
+	generation := b.generation
+	var err error
+	switch b.state {
+	case StateOpen:
+		err = ErrCircuitOpen
+	case StateHalfOpen:
+		if b.probes >= b.HalfOpenRequests {
+			err = ErrCircuitOpen
+		} else {
+			b.probes++
+		}
+	}
+	b.mutex.Unlock()
+	if notify != nil {
+		notify()
+	}
+	return generation, err
+}
+
+// after 记录代generation放行的请求结果
+func (b *CircuitBreaker) after(generation uint64, err error) {
+	b.mutex.Lock()
+	if generation != b.generation {
+		//状态已切换，只计入统计
+		b.record(err)
+		b.mutex.Unlock()
+		return
+	}
+	b.record(err)
+	var notify func()
+	switch {
+	case err == nil:
+		b.consecutive = 0
+		if b.state == StateHalfOpen {
+			b.probeSuccess++
+			if b.probeSuccess >= b.HalfOpenRequests {
+				notify = b.setState(StateClosed)
+			}
+		}
+	default:
+		b.consecutive++
+		if b.state == StateHalfOpen || b.shouldTrip() {
+			notify = b.setState(StateOpen)
+		}
+	}
+	b.mutex.Unlock()
+	if notify != nil {
+		notify()
+	}
+}
+
+// record 计入窗口统计，需持有锁
+func (b *CircuitBreaker) record(err error) {
+	switch {
+	case err == nil:
+		b.success.Add(1)
+	case errors.Is(err, context.DeadlineExceeded):
+		b.timeout.Add(1)
+	default:
+		b.failure.Add(1)
+	}
+}
+
+// shouldTrip 是否达到打开条件，需持有锁
+func (b *CircuitBreaker) shouldTrip() bool {
+	if b.state != StateClosed {
+		return false
+	}
+	if b.ConsecutiveFailures > 0 && b.consecutive >= b.ConsecutiveFailures {
+		return true
+	}
+	//含当前窗口，突发的失败可立即触发
+	failed := b.failure.sumLive() + b.timeout.sumLive()
+	total := failed + b.success.sumLive()
+	return total > 0 && total >= b.MinRequests && float64(failed) >= b.ErrorRate*float64(total)
+}
+
+// Execute 熔断保护下执行f，打开时返回 ErrCircuitOpen
+// f 返回 context.DeadlineExceeded 计为超时，其他错误计为失败，panic 计为失败后继续抛出；ctx 已结束时不执行也不计数
+func (b *CircuitBreaker) Execute(ctx context.Context, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	generation, err := b.before()
+	if err != nil {
+		return err
+	}
+	done := false
+	defer func() {
+		if !done {
+			b.after(generation, errCircuitPanic)
+		}
+	}()
+	err = f()
+	done = true
+	b.after(generation, err)
+	return err
+}
+
+// https://github.com/sony/gobreaker
+// https://github.com/afex/hystrix-go
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerConsecutive(t *testing.T) {
+	b := NewCircuitBreaker(0.5, 100, 20*time.Millisecond)
+	b.ConsecutiveFailures = 3
+	var changes []string
+	b.OnStateChange = func(from, to BreakerState) {
+		changes = append(changes, from.String()+"->"+to.String())
+	}
+	ctx := context.Background()
+	fail := errors.New("fail")
+	for range 3 {
+		if err := b.Execute(ctx, func() error { return fail }); err != fail {
+			t.Fatal(err)
+		}
+	}
+	if b.State() != StateOpen {
+		t.Fatal(b.State())
+	}
+	if err := b.Execute(ctx, func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatal(err)
+	}
+	time.Sleep(25 * time.Millisecond)
+	// 半开探测失败，重新打开
+	if err := b.Execute(ctx, func() error { return context.DeadlineExceeded }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	if b.State() != StateOpen {
+		t.Fatal(b.State())
+	}
+	time.Sleep(25 * time.Millisecond)
+	if b.State() != StateHalfOpen {
+		t.Fatal(b.State())
+	}
+	b.HalfOpenRequests = 2
+	if err := b.Execute(ctx, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if b.State() != StateHalfOpen {
+		t.Fatal(b.State())
+	}
+	if err := b.Execute(ctx, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if b.State() != StateClosed || !reflect.DeepEqual(changes, want) {
+		t.Fatal(b.State(), changes)
+	}
+}
+
+func TestCircuitBreakerErrorRate(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 1000<<31))
+	b := NewCircuitBreaker(0.5, 10, time.Second).SetClock(clock)
+	ctx := context.Background()
+	fail := errors.New("fail")
+	for i := range 10 {
+		b.Execute(ctx, func() error {
+			if i%2 == 0 {
+				return fail
+			}
+			return nil
+		})
+	}
+	if b.State() != StateClosed {
+		t.Fatal(b.State())
+	}
+	// 当前窗口计入统计，无需等待
+	b.Execute(ctx, func() error { return fail })
+	if b.State() != StateOpen {
+		t.Fatal(b.State())
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := b.Execute(canceled, func() error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+}
+
+func TestCircuitBreakerGeneration(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 1000<<31))
+	b := NewCircuitBreaker(0.5, 100, time.Second).SetClock(clock)
+	b.ConsecutiveFailures = 1
+	ctx := context.Background()
+	fail := errors.New("fail")
+	release := make(chan error)
+	done := make(chan error)
+	// 关闭状态放行，半开后才返回
+	for range 2 {
+		go func() {
+			done <- b.Execute(ctx, func() error { return <-release })
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	b.Execute(ctx, func() error { return fail })
+	clock.Advance(time.Second)
+	if b.State() != StateHalfOpen {
+		t.Fatal(b.State())
+	}
+	release <- nil
+	<-done
+	if b.State() != StateHalfOpen {
+		t.Fatal("stale success closed breaker", b.State())
+	}
+	// 旧代的失败也不影响状态
+	if err := b.Execute(ctx, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if b.State() != StateClosed {
+		t.Fatal(b.State())
+	}
+	release <- fail
+	<-done
+	if b.State() != StateClosed {
+		t.Fatal("stale failure reopened breaker", b.State())
+	}
+}
+
+func TestCircuitBreakerPanic(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 1000<<31))
+	b := NewCircuitBreaker(0.5, 100, time.Second).SetClock(clock)
+	b.ConsecutiveFailures = 1
+	ctx := context.Background()
+	b.Execute(ctx, func() error { return errors.New("fail") })
+	clock.Advance(time.Second)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic")
+			}
+		}()
+		b.Execute(ctx, func() error { panic("probe") })
+	}()
+	// 探测 panic 计为失败，重新打开
+	if b.State() != StateOpen {
+		t.Fatal(b.State())
+	}
+	clock.Advance(time.Second)
+	if err := b.Execute(ctx, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if b.State() != StateClosed {
+		t.Fatal(b.State())
+	}
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock 时钟，测试中可用 FakeClock 控制时间
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer 定时器，与 time.Timer 一致
+type Timer interface {
+	C() <-chan time.Time
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time { return t.Timer.C }
+
+// SystemClock 系统时钟
+var SystemClock Clock = systemClock{}
+
+// clockOr c为nil时返回系统时钟
+func clockOr(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
+
+// FakeClock 手动推进的时钟，Advance 时触发到期的定时器
+type FakeClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFakeClock 新建，起始时间为now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now 当前时间
+func (f *FakeClock) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+// Advance 时间前进d，触发到期的定时器
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mutex.Lock()
+	f.now = f.now.Add(d)
+	now := f.now
+	timers := f.timers[:0]
+	var fired []*fakeTimer
+	for _, t := range f.timers {
+		if t.deadline.After(now) {
+			timers = append(timers, t)
+		} else {
+			fired = append(fired, t)
+		}
+	}
+	f.timers = timers
+	f.mutex.Unlock()
+	for _, t := range fired {
+		select {
+		case t.c <- now:
+		default:
+		}
+	}
+}
+
+// NewTimer 新建定时器
+func (f *FakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: f, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	c        chan time.Time
+	deadline time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	active := t.Stop()
+	f := t.clock
+	f.mutex.Lock()
+	t.deadline = f.now.Add(d)
+	if d > 0 {
+		f.timers = append(f.timers, t)
+		f.mutex.Unlock()
+		return active
+	}
+	now := f.now
+	f.mutex.Unlock()
+	select {
+	case t.c <- now:
+	default:
+	}
+	return active
+}
+
+// Stop 同 Go 1.23 起的 time.Timer，丢弃已触发未接收的时间
+func (t *fakeTimer) Stop() bool {
+	f := t.clock
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	select {
+	case <-t.c:
+	default:
+	}
+	for i, v := range f.timers {
+		if v == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
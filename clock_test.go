@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClockTimer(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	timer := clock.NewTimer(time.Second)
+	clock.Advance(time.Second)
+	//已触发未接收的时间在 Reset 时丢弃
+	if timer.Reset(time.Hour) {
+		t.Fatal("expected inactive")
+	}
+	select {
+	case v := <-timer.C():
+		t.Fatal("stale tick", v)
+	default:
+	}
+	clock.Advance(time.Hour)
+	select {
+	case v := <-timer.C():
+		if !v.Equal(time.Unix(0, 0).Add(time.Hour + time.Second)) {
+			t.Fatal(v)
+		}
+	default:
+		t.Fatal("expected tick")
+	}
+	if timer.Stop() {
+		t.Fatal("expected stopped")
+	}
+	timer.Reset(time.Second)
+	if !timer.Stop() {
+		t.Fatal("expected active")
+	}
+	clock.Advance(time.Hour)
+	select {
+	case v := <-timer.C():
+		t.Fatal("stopped timer fired", v)
+	default:
+	}
+}
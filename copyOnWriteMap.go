@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"iter"
+	"maps"
+	"sync"
+	"sync/atomic"
+)
+
+// CopyOnWriteMap (COW)写时复制的map，适用读多写少的注册表，如路由、处理函数、开关
+// 读无锁，写之间用互斥锁串行，修改时复制出副本，完成后原子替换。零值可直接使用
+type CopyOnWriteMap[K comparable, V any] struct {
+	mutex    sync.Mutex
+	m        atomic.Pointer[map[K]V]
+	watchers CopyOnWriteList[func(map[K]V)]
+}
+
+// NewCopyOnWriteMap 新建
+func NewCopyOnWriteMap[K comparable, V any]() *CopyOnWriteMap[K, V] {
+	return &CopyOnWriteMap[K, V]{}
+}
+
+// Snapshot 当前快照，不要修改
+func (c *CopyOnWriteMap[K, V]) Snapshot() map[K]V {
+	if p := c.m.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// Load 读取
+func (c *CopyOnWriteMap[K, V]) Load(key K) (v V, ok bool) {
+	v, ok = c.Snapshot()[key]
+	return
+}
+
+// Len 长度
+func (c *CopyOnWriteMap[K, V]) Len() int {
+	return len(c.Snapshot())
+}
+
+// All 迭代当前快照
+func (c *CopyOnWriteMap[K, V]) All() iter.Seq2[K, V] {
+	return maps.All(c.Snapshot())
+}
+
+// Update 事务，f 在当前数据的副本上批量修改，返回后原子替换并通知观察者
+func (c *CopyOnWriteMap[K, V]) Update(f func(tx map[K]V)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	data := maps.Clone(c.Snapshot())
+	if data == nil {
+		data = make(map[K]V)
+	}
+	f(data)
+	c.m.Store(&data)
+	for _, w := range c.watchers.List() {
+		w(data)
+	}
+}
+
+// Store 写入
+func (c *CopyOnWriteMap[K, V]) Store(key K, value V) {
+	c.Update(func(tx map[K]V) {
+		tx[key] = value
+	})
+}
+
+// Delete 删除
+func (c *CopyOnWriteMap[K, V]) Delete(keys ...K) {
+	c.Update(func(tx map[K]V) {
+		for _, k := range keys {
+			delete(tx, k)
+		}
+	})
+}
+
+// Watch 注册观察者，每次修改后以新快照调用，调用顺序与修改顺序一致
+// 回调在写锁内执行，不要在回调中修改本map。可接入 Universe：
+//
+//	m.Watch(func(s map[K]V) { u.SetSignal(signal, s) })
+func (c *CopyOnWriteMap[K, V]) Watch(f func(map[K]V)) {
+	c.watchers.Add(f)
+}
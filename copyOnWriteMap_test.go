@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"maps"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCopyOnWriteMap(t *testing.T) {
+	var m CopyOnWriteMap[string, int]
+	if _, ok := m.Load("a"); ok || m.Len() != 0 {
+		t.Fatal(m.Snapshot())
+	}
+	var notified []map[string]int
+	m.Watch(func(s map[string]int) { notified = append(notified, s) })
+	m.Store("a", 1)
+	old := m.Snapshot()
+	m.Update(func(tx map[string]int) {
+		tx["b"] = 2
+		tx["c"] = 3
+		delete(tx, "a")
+	})
+	m.Delete("c", "d")
+	if !reflect.DeepEqual(old, map[string]int{"a": 1}) || !reflect.DeepEqual(maps.Collect(m.All()), map[string]int{"b": 2}) {
+		t.Fatal(old, m.Snapshot())
+	}
+	if v, ok := m.Load("b"); !ok || v != 2 {
+		t.Fatal(v, ok)
+	}
+	want := []map[string]int{{"a": 1}, {"b": 2, "c": 3}, {"b": 2}}
+	if !reflect.DeepEqual(notified, want) {
+		t.Fatal(notified)
+	}
+}
+
+func TestCopyOnWriteMapUniverse(t *testing.T) {
+	u := NewUniverse()
+	defer u.Close()
+	got := make(chan any, 1)
+	s := u.NewSignal(nil, func(a any) { got <- a })
+	u.Run()
+	m := NewCopyOnWriteMap[string, string]()
+	m.Watch(func(snapshot map[string]string) { u.SetSignal(s, snapshot) })
+	m.Store("/index", "home")
+	select {
+	case v := <-got:
+		if !reflect.DeepEqual(v, map[string]string{"/index": "home"}) {
+			t.Fatal(v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestCopyOnWriteMapConcurrent(t *testing.T) {
+	m := NewCopyOnWriteMap[int, int]()
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			m.Store(i, i)
+		}()
+		go func() {
+			defer wg.Done()
+			m.Load(i)
+		}()
+	}
+	wg.Wait()
+	if m.Len() != 50 {
+		t.Fatal(m.Len())
+	}
+}
+
+func BenchmarkCopyOnWriteMapLoad(b *testing.B) {
+	m := NewCopyOnWriteMap[int, int]()
+	m.Update(func(tx map[int]int) {
+		for i := range 100 {
+			tx[i] = i
+		}
+	})
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			m.Load(50)
+		}
+	})
+}
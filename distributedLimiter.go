@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// LimiterStore 共享令牌桶存储，多个副本通过同一存储实现全局限流
+// 实现须保证 TakeTokens 原子执行，Redis 可用 RedisTokenBucketScript 实现
+type LimiterStore interface {
+	// TakeTokens 从key对应的桶中最多取n个令牌，返回实际取得的数量
+	// 桶每 per 时间补充 rate 个令牌，上限 size，不存在时视为满桶
+	TakeTokens(ctx context.Context, key string, n, rate, size int64, per time.Duration) (int64, error)
+}
+
+// RedisTokenBucketScript Redis 的 LimiterStore 参考实现
+// KEYS[1]=key ARGV: n rate size per(毫秒)，返回取得的令牌数
+// 以 Redis 服务器时间计算补充，避免各副本时钟偏差重复计入；last 只增不减
+const RedisTokenBucketScript = `
+redis.replicate_commands()
+local n, rate, size, per = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens, last = tonumber(b[1]) or size, tonumber(b[2]) or now
+tokens = math.min(size, tokens + math.max(0, now - last) * rate / per)
+local got = math.min(n, math.floor(tokens))
+redis.call('HSET', KEYS[1], 'tokens', tokens - got, 'last', math.max(last, now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(size * per / rate) + per)
+return got
+`
+
+type memoryBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryLimiterStore 进程内的 LimiterStore，用于测试和单机
+type MemoryLimiterStore struct {
+	mutex   sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+// NewMemoryLimiterStore 新建
+func NewMemoryLimiterStore() *MemoryLimiterStore {
+	return &MemoryLimiterStore{buckets: make(map[string]*memoryBucket)}
+}
+
+// TakeTokens 实现 LimiterStore
+func (m *MemoryLimiterStore) TakeTokens(ctx context.Context, key string, n, rate, size int64, per time.Duration) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: float64(size), last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = min(float64(size), b.tokens+float64(now.Sub(b.last))*float64(rate)/float64(per))
+	b.last = now
+	got := min(n, int64(b.tokens))
+	b.tokens -= float64(got)
+	return got, nil
+}
+
+// DistributedLimiter 基于共享存储的全局令牌桶限流
+// 每次从存储预取 Batch 个令牌在本地消耗，减少往返，代价是各副本最多多占 Batch 个令牌
+// 存储中令牌不足时，按缺口估算补足时间，期间直接拒绝而不访问存储
+type DistributedLimiter struct {
+	//存储中的桶名
+	Key string
+	//每 Snippet 时间补充的令牌数
+	LimitRate int64
+	//令牌上限
+	LimitSize int64
+	Snippet   time.Duration
+	//预取数量
+	Batch int64
+	store LimiterStore
+	mutex sync.Mutex
+	//本地剩余令牌
+	local int64
+	//下次访问存储的时间
+	retryAt time.Time
+	//正在访问存储时非nil，完成后关闭，同一时间只有一个调用者访问存储
+	refilling chan struct{}
+}
+
+// NewDistributedLimiter 新建，limitRate、limitSize 须大于0，batch 不大于 limitSize
+func NewDistributedLimiter(store LimiterStore, key string, limitRate, limitSize int64, snippet time.Duration, batch int64) *DistributedLimiter {
+	if limitRate <= 0 || limitSize <= 0 {
+		panic("DistributedLimiter: limitRate 与 limitSize 须大于0")
+	}
+	d := &DistributedLimiter{
+		Key:       key,
+		LimitRate: limitRate,
+		LimitSize: limitSize,
+		Snippet:   snippet,
+		Batch:     min(max(batch, 1), limitSize),
+		store:     store,
+	}
+	if d.Snippet == 0 {
+		d.Snippet = 100 * time.Millisecond
+	}
+	return d
+}
+
+// take 申请n个令牌，失败时返回仍缺的数量
+// 访问存储时不持有锁，其他调用者等待本次结果或自身ctx结束
+func (d *DistributedLimiter) take(ctx context.Context, n int64) (int64, error) {
+	d.mutex.Lock()
+	for {
+		if d.local >= n {
+			d.local -= n
+			d.mutex.Unlock()
+			return 0, nil
+		}
+		//存储中令牌不足时，在预计补足前不再访问存储
+		if time.Now().Before(d.retryAt) {
+			lack := n - d.local
+			d.mutex.Unlock()
+			return lack, nil
+		}
+		if d.refilling == nil {
+			break
+		}
+		refilling := d.refilling
+		d.mutex.Unlock()
+		select {
+		case <-refilling:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		d.mutex.Lock()
+	}
+	refilling := make(chan struct{})
+	d.refilling = refilling
+	want := max(n-d.local, d.Batch)
+	d.mutex.Unlock()
+	got, err := d.store.TakeTokens(ctx, d.Key, want, d.LimitRate, d.LimitSize, d.Snippet)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.refilling = nil
+	close(refilling)
+	if err != nil {
+		return 0, err
+	}
+	d.local += got
+	if d.local >= n {
+		d.local -= n
+		return 0, nil
+	}
+	//取得的令牌留在本地，下次使用
+	lack := n - d.local
+	d.retryAt = time.Now().Add(d.duration(lack))
+	return lack, nil
+}
+
+// duration 补充n个令牌所需时间
+func (d *DistributedLimiter) duration(n int64) time.Duration {
+	return time.Duration((n*int64(d.Snippet) + d.LimitRate - 1) / d.LimitRate)
+}
+
+// TakeContext 申请n个令牌，取不到足够数量时立即返回错误
+func (d *DistributedLimiter) TakeContext(ctx context.Context, n int64) error {
+	lack, err := d.take(ctx, n)
+	if err != nil {
+		return err
+	}
+	if lack > 0 {
+		return errors.New("rate limit")
+	}
+	return nil
+}
+
+// Take 申请n个令牌，取不到足够数量时立即返回错误
+func (d *DistributedLimiter) Take(n int64) error {
+	return d.TakeContext(context.Background(), n)
+}
+
+// Allow 申请1个令牌
+func (d *DistributedLimiter) Allow() bool {
+	return d.Take(1) == nil
+}
+
+// Wait 申请n个令牌，不足时按缺口估算等待后重试
+func (d *DistributedLimiter) Wait(ctx context.Context, n int64) error {
+	if n > d.LimitSize {
+		return errors.New("rate limit exceeds limit size")
+	}
+	for {
+		lack, err := d.take(ctx, n)
+		if err != nil {
+			return err
+		}
+		if lack == 0 {
+			return nil
+		}
+		if err := sleepContext(ctx, d.duration(lack)); err != nil {
+			return err
+		}
+	}
+}
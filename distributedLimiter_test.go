@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingStore struct {
+	LimiterStore
+	calls int64
+}
+
+func (c *countingStore) TakeTokens(ctx context.Context, key string, n, rate, size int64, per time.Duration) (int64, error) {
+	atomic.AddInt64(&c.calls, 1)
+	return c.LimiterStore.TakeTokens(ctx, key, n, rate, size, per)
+}
+
+func TestDistributedLimiter(t *testing.T) {
+	store := &countingStore{LimiterStore: NewMemoryLimiterStore()}
+	//3个副本共享每秒100个令牌，上限100
+	var replicas []*DistributedLimiter
+	for range 3 {
+		replicas = append(replicas, NewDistributedLimiter(store, "api", 100, 100, time.Second, 10))
+	}
+	var count int64
+	var wg sync.WaitGroup
+	for _, r := range replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				if r.Allow() {
+					atomic.AddInt64(&count, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if count < 90 || count > 101 {
+		t.Fatal(count)
+	}
+	//本地预取减少往返
+	if store.calls > 3*100/2 {
+		t.Fatal(store.calls)
+	}
+}
+
+func TestDistributedLimiterWait(t *testing.T) {
+	store := NewMemoryLimiterStore()
+	d := NewDistributedLimiter(store, "job", 1, 5, time.Millisecond, 5)
+	ctx := context.Background()
+	if err := d.Take(5); err != nil {
+		t.Fatal(err)
+	}
+	prev := time.Now()
+	if err := d.Wait(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(prev) < 4*time.Millisecond {
+		t.Fatal(time.Since(prev))
+	}
+	if err := d.Wait(ctx, 6); err == nil {
+		t.Fatal("expected error")
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := d.TakeContext(canceled, 100); !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+}
+
+type blockingStore struct {
+	LimiterStore
+	release chan struct{}
+}
+
+func (b *blockingStore) TakeTokens(ctx context.Context, key string, n, rate, size int64, per time.Duration) (int64, error) {
+	<-b.release
+	return b.LimiterStore.TakeTokens(ctx, key, n, rate, size, per)
+}
+
+func TestDistributedLimiterSlowStore(t *testing.T) {
+	store := &blockingStore{LimiterStore: NewMemoryLimiterStore(), release: make(chan struct{})}
+	d := NewDistributedLimiter(store, "slow", 100, 100, time.Second, 10)
+	done := make(chan error)
+	go func() {
+		done <- d.Take(1)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	//等待存储期间，ctx 结束的调用者不被阻塞
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := d.TakeContext(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	close(store.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	//本地预取的令牌可直接使用
+	for range 9 {
+		if !d.Allow() {
+			t.Fatal("expected local tokens")
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	NewDistributedLimiter(store, "zero", 0, 100, time.Second, 10)
+}
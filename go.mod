@@ -1,3 +1,3 @@
 module github.com/duomi520/utils
 
-go 1.22
+go 1.23
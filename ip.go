@@ -1,21 +1,142 @@
 package utils
 
-import "net"
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"path"
+)
 
-//PrivateIP4 本地IP4地址
-func PrivateIP4() string {
-	addrs, err := net.InterfaceAddrs()
+// LocalAddr 本地网卡地址
+type LocalAddr struct {
+	//网卡名
+	Interface string
+	//网卡序号
+	Index int
+	Addr  netip.Addr
+	//地址所在网段
+	Prefix netip.Prefix
+}
+
+// 地址族
+const (
+	FamilyAny = iota
+	FamilyIPv4
+	FamilyIPv6
+)
+
+// AddrFilter 本地地址筛选条件，零值表示不限（回环地址除外）
+type AddrFilter struct {
+	//地址族 FamilyAny FamilyIPv4 FamilyIPv6
+	Family int
+	//地址范围，均为false时不限
+	Private, Public, LinkLocal bool
+	//是否包含回环地址
+	Loopback bool
+	//排除的网卡名，支持通配符，例：docker0 veth* br-*
+	ExcludeInterfaces []string
+}
+
+// Match 判断地址是否满足条件
+func (f AddrFilter) Match(a LocalAddr) bool {
+	ip := a.Addr
+	switch f.Family {
+	case FamilyIPv4:
+		if !ip.Is4() {
+			return false
+		}
+	case FamilyIPv6:
+		if !ip.Is6() {
+			return false
+		}
+	}
+	if ip.IsLoopback() && !f.Loopback {
+		return false
+	}
+	if f.Private || f.Public || f.LinkLocal {
+		private := ip.IsPrivate()
+		linkLocal := ip.IsLinkLocalUnicast()
+		public := ip.IsGlobalUnicast() && !private
+		if !(f.Private && private || f.Public && public || f.LinkLocal && linkLocal) {
+			return false
+		}
+	}
+	for _, pattern := range f.ExcludeInterfaces {
+		if ok, _ := path.Match(pattern, a.Interface); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// LocalAddrs 列出已启用网卡上满足条件的地址，按网卡序号排列
+func LocalAddrs(f AddrFilter) ([]LocalAddr, error) {
+	ifaces, err := net.Interfaces()
 	if err != nil {
-		return ""
+		return nil, err
+	}
+	var list []LocalAddr
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addrs {
+			ipNet, ok := address.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip, ok := netip.AddrFromSlice(ipNet.IP)
+			if !ok {
+				continue
+			}
+			ip = ip.Unmap()
+			ones, _ := ipNet.Mask.Size()
+			a := LocalAddr{
+				Interface: iface.Name,
+				Index:     iface.Index,
+				Addr:      ip,
+				Prefix:    netip.PrefixFrom(ip, ones).Masked(),
+			}
+			if f.Match(a) {
+				list = append(list, a)
+			}
+		}
+	}
+	return list, nil
+}
+
+// PreferredAddr 在满足条件的地址中按prefer给出的网段顺序选择，均不命中时返回第一个地址
+func PreferredAddr(f AddrFilter, prefer ...netip.Prefix) (netip.Addr, error) {
+	list, err := LocalAddrs(f)
+	if err != nil {
+		return netip.Addr{}, err
 	}
-	for _, address := range addrs {
-		if ipNet, ok := address.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
-			if ipNet.IP.To4() != nil {
-				if ipNet.IP.IsPrivate() {
-					return ipNet.IP.String()
-				}
+	return pickAddr(list, prefer)
+}
+
+func pickAddr(list []LocalAddr, prefer []netip.Prefix) (netip.Addr, error) {
+	if len(list) == 0 {
+		return netip.Addr{}, errors.New("no matching local address")
+	}
+	for _, p := range prefer {
+		for _, a := range list {
+			if p.Contains(a.Addr) {
+				return a.Addr, nil
 			}
 		}
 	}
-	return ""
+	return list[0].Addr, nil
+}
+
+// PrivateIP4 本地IP4地址，取序号最小的网卡上的第一个私有地址
+func PrivateIP4() string {
+	ip, err := PreferredAddr(AddrFilter{Family: FamilyIPv4, Private: true})
+	if err != nil {
+		return ""
+	}
+	return ip.String()
 }
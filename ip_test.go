@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestAddrFilter(t *testing.T) {
+	addr := func(name, s string) LocalAddr {
+		return LocalAddr{Interface: name, Addr: netip.MustParseAddr(s)}
+	}
+	var tests = []struct {
+		filter AddrFilter
+		addr   LocalAddr
+		result bool
+	}{
+		{AddrFilter{}, addr("lo", "127.0.0.1"), false},
+		{AddrFilter{Loopback: true}, addr("lo", "127.0.0.1"), true},
+		{AddrFilter{Family: FamilyIPv4}, addr("eth0", "fe80::1"), false},
+		{AddrFilter{Family: FamilyIPv6}, addr("eth0", "fe80::1"), true},
+		{AddrFilter{Private: true}, addr("eth0", "192.168.1.2"), true},
+		{AddrFilter{Private: true}, addr("eth0", "8.8.8.8"), false},
+		{AddrFilter{Public: true}, addr("eth0", "8.8.8.8"), true},
+		{AddrFilter{Public: true}, addr("eth0", "fd00::1"), false},
+		{AddrFilter{Private: true}, addr("eth0", "fd00::1"), true},
+		{AddrFilter{LinkLocal: true}, addr("eth0", "169.254.0.1"), true},
+		{AddrFilter{Private: true, Public: true}, addr("eth0", "fe80::1"), false},
+		{AddrFilter{ExcludeInterfaces: []string{"docker0", "veth*"}}, addr("docker0", "172.17.0.1"), false},
+		{AddrFilter{ExcludeInterfaces: []string{"docker0", "veth*"}}, addr("veth12ab", "172.18.0.1"), false},
+		{AddrFilter{ExcludeInterfaces: []string{"docker0", "veth*"}}, addr("eth0", "172.18.0.1"), true},
+	}
+	for i := range tests {
+		if tests[i].filter.Match(tests[i].addr) != tests[i].result {
+			t.Fatal(i, tests[i].addr, tests[i].result)
+		}
+	}
+}
+
+func TestPickAddr(t *testing.T) {
+	list := []LocalAddr{
+		{Interface: "docker0", Addr: netip.MustParseAddr("172.17.0.1")},
+		{Interface: "eth0", Addr: netip.MustParseAddr("10.0.0.5")},
+		{Interface: "tun0", Addr: netip.MustParseAddr("192.168.100.2")},
+	}
+	var tests = []struct {
+		prefer []netip.Prefix
+		result string
+	}{
+		{nil, "172.17.0.1"},
+		{[]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, "10.0.0.5"},
+		{[]netip.Prefix{netip.MustParsePrefix("1.0.0.0/8"), netip.MustParsePrefix("192.168.0.0/16")}, "192.168.100.2"},
+	}
+	for i := range tests {
+		ip, err := pickAddr(list, tests[i].prefer)
+		if err != nil || ip.String() != tests[i].result {
+			t.Fatal(i, ip, err, tests[i].result)
+		}
+	}
+	if _, err := pickAddr(nil, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestLocalAddrs(t *testing.T) {
+	list, err := LocalAddrs(AddrFilter{Loopback: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range list {
+		if !a.Prefix.Contains(a.Addr) {
+			t.Fatal(a)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type trieNode[V any] struct {
+	child [2]*trieNode[V]
+	value V
+	//true 表示该节点对应一条规则
+	set bool
+}
+
+// prefixTrie 二进制前缀树，最长前缀匹配，查找复杂度 O(前缀长度)
+type prefixTrie[V any] struct {
+	v4, v6 trieNode[V]
+}
+
+func (t *prefixTrie[V]) root(a netip.Addr) (*trieNode[V], []byte) {
+	if a.Is4() {
+		b := a.As4()
+		return &t.v4, b[:]
+	}
+	b := a.As16()
+	return &t.v6, b[:]
+}
+
+// insert 插入，merge 决定同一前缀重复插入时保留的值
+func (t *prefixTrie[V]) insert(p netip.Prefix, v V, merge func(old, new V) V) {
+	addr, bits := p.Addr(), p.Bits()
+	if addr.Is4In6() {
+		addr, bits = addr.Unmap(), max(bits-96, 0)
+	}
+	n, b := t.root(addr)
+	for i := range bits {
+		bit := b[i>>3] >> (7 - i&7) & 1
+		if n.child[bit] == nil {
+			n.child[bit] = &trieNode[V]{}
+		}
+		n = n.child[bit]
+	}
+	if n.set && merge != nil {
+		v = merge(n.value, v)
+	}
+	n.value = v
+	n.set = true
+}
+
+func (t *prefixTrie[V]) lookup(a netip.Addr) (v V, ok bool) {
+	a = a.Unmap()
+	n, b := t.root(a)
+	for i := 0; n != nil; i++ {
+		if n.set {
+			v, ok = n.value, true
+		}
+		if i == len(b)*8 {
+			break
+		}
+		n = n.child[b[i>>3]>>(7-i&7)&1]
+	}
+	return
+}
+
+// IPFilter IP黑白名单，最长前缀匹配的规则生效，同一前缀同时出现时deny优先
+// 规则以快照形式原子替换，支持热加载
+type IPFilter struct {
+	//串行化写入，读取无锁
+	mutex sync.Mutex
+	rules atomic.Pointer[ipRules]
+}
+
+// ipRules IPFilter 的规则快照
+type ipRules struct {
+	trie *prefixTrie[bool]
+	//无规则命中时是否放行
+	defaultAllow bool
+}
+
+// NewIPFilter 新建
+func NewIPFilter(defaultAllow bool) *IPFilter {
+	f := &IPFilter{}
+	f.rules.Store(&ipRules{trie: &prefixTrie[bool]{}, defaultAllow: defaultAllow})
+	return f
+}
+
+// update 复制快照修改后替换
+func (f *IPFilter) update(change func(r *ipRules)) {
+	f.mutex.Lock()
+	r := *f.rules.Load()
+	change(&r)
+	f.rules.Store(&r)
+	f.mutex.Unlock()
+}
+
+// DefaultAllow 无规则命中时是否放行
+func (f *IPFilter) DefaultAllow() bool {
+	return f.rules.Load().defaultAllow
+}
+
+// SetDefaultAllow 设置无规则命中时是否放行
+func (f *IPFilter) SetDefaultAllow(allow bool) {
+	f.update(func(r *ipRules) { r.defaultAllow = allow })
+}
+
+// Allowed 判断地址是否放行，无效地址不放行
+func (f *IPFilter) Allowed(a netip.Addr) bool {
+	if !a.IsValid() {
+		return false
+	}
+	r := f.rules.Load()
+	if allow, ok := r.trie.lookup(a); ok {
+		return allow
+	}
+	return r.defaultAllow
+}
+
+// Load 从r读取规则并整体替换，出错时保留原规则
+// 每行一条：allow|deny IP或CIDR，# 开头为注释，例：
+//
+//	allow 10.0.0.0/8
+//	deny 10.1.2.3
+//	deny 2001:db8::/32
+func (f *IPFilter) Load(r io.Reader) error {
+	t, err := parseIPRules(r)
+	if err != nil {
+		return err
+	}
+	f.update(func(r *ipRules) { r.trie = t })
+	return nil
+}
+
+// LoadFile 从文件读取规则
+func (f *IPFilter) LoadFile(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return f.Load(file)
+}
+
+// WatchFile 返回周期检查文件修改时间并热加载的任务，可加入Timing运行，加载失败时调用onError
+// 返回的任务不可并发执行
+func (f *IPFilter) WatchFile(name string, interval time.Duration, onError func(error)) func() time.Duration {
+	var modTime time.Time
+	return func() time.Duration {
+		info, err := os.Stat(name)
+		if err == nil && !info.ModTime().Equal(modTime) {
+			if err = f.LoadFile(name); err == nil {
+				modTime = info.ModTime()
+			}
+		}
+		if err != nil && onError != nil {
+			onError(err)
+		}
+		return interval
+	}
+}
+
+func parseIPRules(r io.Reader) (*prefixTrie[bool], error) {
+	t := &prefixTrie[bool]{}
+	denyFirst := func(old, new bool) bool { return old && new }
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: invalid rule %q", line, text)
+		}
+		var allow bool
+		switch fields[0] {
+		case "allow":
+			allow = true
+		case "deny":
+			allow = false
+		default:
+			return nil, fmt.Errorf("line %d: unknown action %q", line, fields[0])
+		}
+		p, err := ParsePrefix(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		t.insert(p, allow, denyFirst)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ParsePrefix 解析IP或CIDR，单个IP视为全长前缀
+func ParsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		return netip.ParsePrefix(s)
+	}
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(a, a.BitLen()), nil
+}
+
+// SubnetLimiter 按网段限流，最长前缀匹配的限流器生效
+// 限流器需另行运行 Run 或 Task 补充令牌
+type SubnetLimiter struct {
+	mutex sync.RWMutex
+	trie  prefixTrie[*TokenBucketLimiter]
+}
+
+// Set 设置网段的限流器，重复设置时覆盖
+func (s *SubnetLimiter) Set(p netip.Prefix, l *TokenBucketLimiter) {
+	s.mutex.Lock()
+	s.trie.insert(p, l, nil)
+	s.mutex.Unlock()
+}
+
+// Take 从地址所属网段的限流器申请n个令牌，无匹配网段时不限流
+func (s *SubnetLimiter) Take(a netip.Addr, n int64) error {
+	if !a.IsValid() {
+		return errors.New("invalid address")
+	}
+	s.mutex.RLock()
+	l, ok := s.trie.lookup(a)
+	s.mutex.RUnlock()
+	if !ok || l == nil {
+		return nil
+	}
+	return l.Take(n)
+}
+
+// https://github.com/yl2chen/cidranger
+// https://github.com/gaissmai/bart
@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIPFilter(t *testing.T) {
+	rules := `
+# 内网放行，个别地址拒绝
+allow 10.0.0.0/8
+deny 10.1.0.0/16
+allow 10.1.2.3
+deny 192.168.1.1
+allow 192.168.1.1
+allow 2001:db8::/32
+deny 2001:db8:1::/48
+`
+	f := NewIPFilter(false)
+	if err := f.Load(strings.NewReader(rules)); err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		arg    string
+		result bool
+	}{
+		{"10.2.3.4", true},
+		{"10.1.2.4", false},
+		{"10.1.2.3", true},
+		{"192.168.1.1", false},
+		{"8.8.8.8", false},
+		{"::ffff:10.2.3.4", true},
+		{"2001:db8::1", true},
+		{"2001:db8:1::1", false},
+		{"2001:db9::1", false},
+	}
+	for i := range tests {
+		if f.Allowed(netip.MustParseAddr(tests[i].arg)) != tests[i].result {
+			t.Fatal(i, tests[i].arg, tests[i].result)
+		}
+	}
+	if f.Allowed(netip.Addr{}) {
+		t.Fatal("invalid address allowed")
+	}
+	f.SetDefaultAllow(true)
+	if !f.DefaultAllow() || !f.Allowed(netip.MustParseAddr("8.8.8.8")) {
+		t.Fatal("default allow")
+	}
+	if err := f.Load(strings.NewReader("permit 1.2.3.4")); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := f.Load(strings.NewReader("deny 1.2.3.400")); err == nil {
+		t.Fatal("expected error")
+	}
+	if f.Allowed(netip.MustParseAddr("10.1.2.4")) {
+		t.Fatal("rules should be kept after failed load")
+	}
+}
+
+func TestIPFilterWatchFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "rules.txt")
+	if err := os.WriteFile(name, []byte("deny 1.2.3.4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := NewIPFilter(true)
+	task := f.WatchFile(name, time.Second, func(err error) { t.Fatal(err) })
+	if task() != time.Second || f.Allowed(netip.MustParseAddr("1.2.3.4")) {
+		t.Fatal("load failed")
+	}
+	if err := os.WriteFile(name, []byte("allow 1.2.3.4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(name, later, later); err != nil {
+		t.Fatal(err)
+	}
+	task()
+	if !f.Allowed(netip.MustParseAddr("1.2.3.4")) {
+		t.Fatal("reload failed")
+	}
+}
+
+func TestIPFilterReloadConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(a, []byte("deny 1.2.3.4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("deny 5.6.7.8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := NewIPFilter(true)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				f.Allowed(netip.MustParseAddr("9.9.9.9"))
+			}
+		}
+	}()
+	//两个任务各自记录修改时间
+	ta := f.WatchFile(a, time.Second, func(err error) { t.Error(err) })
+	tb := f.WatchFile(b, time.Second, func(err error) { t.Error(err) })
+	ta()
+	tb()
+	if !f.Allowed(netip.MustParseAddr("1.2.3.4")) || f.Allowed(netip.MustParseAddr("5.6.7.8")) {
+		t.Fatal("expected rules of b")
+	}
+	//a 未修改，不重新加载
+	ta()
+	if f.Allowed(netip.MustParseAddr("5.6.7.8")) {
+		t.Fatal("a reloaded without change")
+	}
+	f.SetDefaultAllow(false)
+	close(stop)
+	<-done
+	if f.Allowed(netip.MustParseAddr("9.9.9.9")) {
+		t.Fatal("default deny")
+	}
+}
+
+func TestSubnetLimiter(t *testing.T) {
+	var s SubnetLimiter
+	wide := NewTokenBucketLimiter(10, 10, time.Second)
+	narrow := NewTokenBucketLimiter(1, 1, time.Second)
+	s.Set(netip.MustParsePrefix("10.0.0.0/8"), wide)
+	s.Set(netip.MustParsePrefix("10.1.0.0/16"), narrow)
+	if err := s.Take(netip.MustParseAddr("10.1.0.1"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Take(netip.MustParseAddr("10.1.0.2"), 1); err == nil {
+		t.Fatal("expected rate limit")
+	}
+	if err := s.Take(netip.MustParseAddr("10.2.0.1"), 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Take(netip.MustParseAddr("8.8.8.8"), 100); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func BenchmarkIPFilterAllowed(b *testing.B) {
+	f := NewIPFilter(false)
+	f.Load(strings.NewReader("allow 10.0.0.0/8\ndeny 10.1.0.0/16\n"))
+	a := netip.MustParseAddr("10.2.3.4")
+	for i := 0; i < b.N; i++ {
+		f.Allowed(a)
+	}
+}
@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 分片数，2的幂
+const keyedLimiterShards = 64
+
+type keyedEntry struct {
+	limiter *TokenBucketLimiter
+	//最近使用的单调时钟纳秒数
+	lastUsed int64
+}
+
+type keyedShard struct {
+	mutex sync.RWMutex
+	m     map[string]*keyedEntry
+	//Padding
+	_ [7]int64
+}
+
+type limitOverride struct {
+	rate, size int64
+}
+
+// KeyedLimiter 按键（API key、IP、租户等）限流，每个键一个惰性补充的令牌桶，按需创建
+// 键按 Hash64WY 分片以降低锁竞争，空闲超过 TTL 且令牌桶已补满的键由 Task 清理
+type KeyedLimiter struct {
+	//默认速率，每个 Snippet 加入的令牌数
+	LimitRate int64
+	//默认大小
+	LimitSize int64
+	Snippet   time.Duration
+	//空闲淘汰时间
+	TTL       time.Duration
+	seed      uint64
+	shards    [keyedLimiterShards]keyedShard
+	overrides CopyOnWriteMap[string, limitOverride]
+}
+
+// NewKeyedLimiter 新建，ttl 为0时默认1分钟
+func NewKeyedLimiter(limitRate, limitSize int64, snippet, ttl time.Duration) *KeyedLimiter {
+	k := &KeyedLimiter{
+		LimitRate: limitRate,
+		LimitSize: limitSize,
+		Snippet:   snippet,
+		TTL:       ttl,
+		seed:      uint64(time.Now().UnixNano()),
+	}
+	if k.TTL == 0 {
+		k.TTL = time.Minute
+	}
+	for i := range k.shards {
+		k.shards[i].m = make(map[string]*keyedEntry)
+	}
+	return k
+}
+
+func (k *KeyedLimiter) shard(key string) *keyedShard {
+	return &k.shards[Hash64WY(key, k.seed)&(keyedLimiterShards-1)]
+}
+
+// Get 取得键对应的限流器，不存在时创建
+func (k *KeyedLimiter) Get(key string) *TokenBucketLimiter {
+	s := k.shard(key)
+	now := monotonicNow()
+	s.mutex.RLock()
+	e, ok := s.m[key]
+	if ok {
+		//持有读锁时更新，避免与 Evict 竞争
+		atomic.StoreInt64(&e.lastUsed, now)
+		s.mutex.RUnlock()
+		return e.limiter
+	}
+	s.mutex.RUnlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if e, ok = s.m[key]; ok {
+		atomic.StoreInt64(&e.lastUsed, now)
+		return e.limiter
+	}
+	rate, size := k.LimitRate, k.LimitSize
+	if o, ok := k.overrides.Load(key); ok {
+		rate, size = o.rate, o.size
+	}
+	e = &keyedEntry{
+		limiter:  NewLazyTokenBucketLimiter(rate, size, k.Snippet),
+		lastUsed: now,
+	}
+	s.m[key] = e
+	return e.limiter
+}
+
+// Take 从键对应的限流器申请n个令牌，取不到足够数量时立即返回错误
+func (k *KeyedLimiter) Take(key string, n int64) error {
+	return k.Get(key).Take(n)
+}
+
+// Wait 从键对应的限流器申请n个令牌，不足时阻塞等待
+func (k *KeyedLimiter) Wait(ctx context.Context, key string, n int64) error {
+	return k.Get(key).Wait(ctx, n)
+}
+
+// SetOverride 单独设置键的速率与大小，已存在的限流器被替换，令牌重新计满
+func (k *KeyedLimiter) SetOverride(key string, limitRate, limitSize int64) {
+	k.overrides.Store(key, limitOverride{rate: limitRate, size: limitSize})
+	k.remove(key)
+}
+
+// RemoveOverride 取消单独设置，恢复默认
+func (k *KeyedLimiter) RemoveOverride(key string) {
+	k.overrides.Delete(key)
+	k.remove(key)
+}
+
+func (k *KeyedLimiter) remove(key string) {
+	s := k.shard(key)
+	s.mutex.Lock()
+	delete(s.m, key)
+	s.mutex.Unlock()
+}
+
+// Len 当前键数
+func (k *KeyedLimiter) Len() int {
+	var n int
+	for i := range k.shards {
+		s := &k.shards[i]
+		s.mutex.RLock()
+		n += len(s.m)
+		s.mutex.RUnlock()
+	}
+	return n
+}
+
+// idle 键可淘汰的空闲时长，不短于令牌桶补满所需时间，否则重建的满桶会绕过限流
+// 速率不大于0时永不淘汰
+func (k *KeyedLimiter) idle(l *TokenBucketLimiter) int64 {
+	if l.LimitRate <= 0 {
+		return math.MaxInt64
+	}
+	fill := float64(l.LimitSize) * float64(l.Snippet) / float64(l.LimitRate)
+	return int64(max(float64(k.TTL), min(fill, math.MaxInt64/2)))
+}
+
+// Evict 淘汰空闲超过 TTL 且令牌桶已补满的键，返回淘汰数
+func (k *KeyedLimiter) Evict() int {
+	now := monotonicNow()
+	var n int
+	for i := range k.shards {
+		s := &k.shards[i]
+		s.mutex.Lock()
+		for key, e := range s.m {
+			if now-atomic.LoadInt64(&e.lastUsed) >= k.idle(e.limiter) {
+				delete(s.m, key)
+				n++
+			}
+		}
+		s.mutex.Unlock()
+	}
+	return n
+}
+
+// Task 淘汰空闲键，返回下次执行间隔，可加入 Timing 运行
+func (k *KeyedLimiter) Task() time.Duration {
+	k.Evict()
+	return k.TTL / 2
+}
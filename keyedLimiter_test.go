@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedLimiter(t *testing.T) {
+	//每10ms补充1个，补满约20ms
+	k := NewKeyedLimiter(1, 2, 10*time.Millisecond, 20*time.Millisecond)
+	if k.Take("a", 2) != nil || k.Take("a", 1) == nil {
+		t.Fatal("key a")
+	}
+	// 各键独立
+	if k.Take("b", 2) != nil {
+		t.Fatal("key b")
+	}
+	if k.Get("a") != k.Get("a") || k.Len() != 2 {
+		t.Fatal(k.Len())
+	}
+	k.SetOverride("vip", 10, 100)
+	if l := k.Get("vip"); l.LimitRate != 10 || l.LimitSize != 100 || l.Take(100) != nil {
+		t.Fatal(l)
+	}
+	k.SetOverride("a", 5, 5)
+	if l := k.Get("a"); l.LimitSize != 5 || l.Take(5) != nil {
+		t.Fatal(l)
+	}
+	k.RemoveOverride("a")
+	if l := k.Get("a"); l.LimitSize != 2 {
+		t.Fatal(l)
+	}
+	time.Sleep(30 * time.Millisecond)
+	k.Get("b")
+	// vip 补满需100ms，暂不淘汰
+	if n := k.Evict(); n != 1 || k.Len() != 2 {
+		t.Fatal(n, k.Len())
+	}
+	if k.Task() != 10*time.Millisecond {
+		t.Fatal(k.Task())
+	}
+	// 空闲超过 TTL 但未补满，保留原令牌桶
+	k = NewKeyedLimiter(1, 5, 10*time.Millisecond, 10*time.Millisecond)
+	if k.Take("t", 5) != nil {
+		t.Fatal("drain")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := k.Evict(); n != 0 || k.Take("t", 5) == nil {
+		t.Fatal(n)
+	}
+}
+
+func TestKeyedLimiterConcurrent(t *testing.T) {
+	k := NewKeyedLimiter(1, 10, time.Second, time.Minute)
+	var wg sync.WaitGroup
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				k.Take(strconv.Itoa((i+j)%32), 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if k.Len() != 32 {
+		t.Fatal(k.Len())
+	}
+}
+
+func BenchmarkKeyedLimiter(b *testing.B) {
+	k := NewKeyedLimiter(1000, 1000, time.Second, time.Minute)
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			k.Take(keys[i&1023], 1)
+			i++
+		}
+	})
+}
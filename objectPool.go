@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ObjectPool 泛型对象池，T 宜为指针类型，避免归还时装箱分配
+// maxIdle 为0时基于 sync.Pool，空闲对象可被GC回收；大于0时基于定长队列，最多保留maxIdle个空闲对象
+type ObjectPool[T any] struct {
+	//归还时重置对象，为nil时不重置
+	Reset func(T)
+	//取出时校验对象，返回false时丢弃并重新取，为nil时不校验
+	Validate func(T) bool
+	//对象大小，如切片长度，用于自校准，大小超过校准值两倍的对象归还时丢弃；为nil时不校准
+	Size func(T) int
+	//新建对象，参数为校准后的容量，未校准时为0
+	new  func(int) T
+	pool sync.Pool
+	idle chan T
+	calibrator
+}
+
+// NewObjectPool 新建
+func NewObjectPool[T any](new func(size int) T, maxIdle int) *ObjectPool[T] {
+	o := &ObjectPool[T]{new: new}
+	if maxIdle > 0 {
+		o.idle = make(chan T, maxIdle)
+	}
+	return o
+}
+
+func (o *ObjectPool[T]) get() (x T, ok bool) {
+	if o.idle != nil {
+		select {
+		case x = <-o.idle:
+			return x, true
+		default:
+			return x, false
+		}
+	}
+	v := o.pool.Get()
+	if v == nil {
+		return x, false
+	}
+	return v.(T), true
+}
+
+// Get 取出
+func (o *ObjectPool[T]) Get() T {
+	for {
+		x, ok := o.get()
+		if !ok {
+			return o.new(int(atomic.LoadInt64(&o.defaultSize)))
+		}
+		if o.Validate == nil || o.Validate(x) {
+			return x
+		}
+	}
+}
+
+// Put 归还
+func (o *ObjectPool[T]) Put(x T) {
+	if o.Size != nil {
+		n := o.Size(x)
+		o.record(n)
+		if d := atomic.LoadInt64(&o.defaultSize); d > 0 && int64(n) > 2*d {
+			return
+		}
+	}
+	if o.Reset != nil {
+		o.Reset(x)
+	}
+	if o.idle != nil {
+		select {
+		case o.idle <- x:
+		default:
+		}
+		return
+	}
+	o.pool.Put(x)
+}
+
+// DefaultSize 当前校准值
+func (o *ObjectPool[T]) DefaultSize() int {
+	return int(atomic.LoadInt64(&o.defaultSize))
+}
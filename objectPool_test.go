@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"testing"
+)
+
+type objectPoolTemp struct {
+	data   []int
+	broken bool
+}
+
+func TestObjectPool(t *testing.T) {
+	var created int
+	o := NewObjectPool(func(size int) *objectPoolTemp {
+		created++
+		return &objectPoolTemp{data: make([]int, 0, size)}
+	}, 2)
+	o.Reset = func(x *objectPoolTemp) { x.data = x.data[:0] }
+	o.Validate = func(x *objectPoolTemp) bool { return !x.broken }
+	a, b, c := o.Get(), o.Get(), o.Get()
+	a.data = append(a.data, 1, 2, 3)
+	o.Put(a)
+	o.Put(b)
+	// 超过maxIdle丢弃
+	o.Put(c)
+	if len(o.idle) != 2 || created != 3 {
+		t.Fatal(len(o.idle), created)
+	}
+	x := o.Get()
+	if x != a || len(x.data) != 0 {
+		t.Fatal(x)
+	}
+	b.broken = true
+	// b 校验失败被丢弃，新建对象
+	if y := o.Get(); y == b || created != 4 {
+		t.Fatal(y, created)
+	}
+}
+
+func TestObjectPoolCalibrate(t *testing.T) {
+	o := NewObjectPool(func(size int) *[]int {
+		s := make([]int, 0, size)
+		return &s
+	}, 0)
+	o.Size = func(x *[]int) int { return len(*x) }
+	o.Reset = func(x *[]int) { *x = (*x)[:0] }
+	for range calibrateCallsThreshold + 1 {
+		x := o.Get()
+		*x = append(*x, make([]int, 1000)...)
+		o.Put(x)
+	}
+	if o.DefaultSize() != 512 {
+		t.Fatal(o.DefaultSize())
+	}
+	if x := o.new(o.DefaultSize()); cap(*x) != 512 {
+		t.Fatal(cap(*x))
+	}
+}
+
+func BenchmarkObjectPool(b *testing.B) {
+	o := NewObjectPool(func(size int) *objectPoolTemp {
+		return &objectPoolTemp{data: make([]int, 0, size)}
+	}, 0)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			o.Put(o.Get())
+		}
+	})
+}
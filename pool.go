@@ -2,6 +2,9 @@ package utils
 
 import (
 	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 )
@@ -15,72 +18,346 @@ const (
 	calibrateCallsThreshold int64 = 42000
 )
 
-// Pool
+// Pool 分级字节池，按容量的2的对数分为poolSteps级，每级一个sync.Pool
+// 第i级存放容量在[2^i, 2^(i+1))的对象，从第i级取出的对象容量不小于2^i
 type Pool struct {
-	slicePool, byteBufferPool sync.Pool
-	array                     [poolSteps]int64
+	slicePools, bufferPools [poolSteps]sync.Pool
+	calibrator
 	//Padding
-	_           [7]int64
-	calibrating int64
-	//Padding
-	_           [7]int64
-	defaultSize int64
+	_ [7]int64
+	//统计计数
+	allocs, misses, frees, dropped int64
+	//调试模式 1-开启
+	debug       int32
+	debugMutex  sync.Mutex
+	outstanding map[any]PoolLeak
+	report      func(error)
 }
 
-func (p *Pool) AllocSlice() *[]byte {
-	v := p.slicePool.Get()
+// PoolStats 字节池统计快照
+type PoolStats struct {
+	//取出次数
+	Allocs int64
+	//池中无可用对象而新建的次数
+	Misses int64
+	//归还次数
+	Frees int64
+	//归还时因容量过小或过大未入池的次数
+	Dropped int64
+	//校准次数
+	Calibrations int64
+	//当前校准值
+	DefaultSize int64
+	//调试模式下未归还的对象数
+	Outstanding int
+}
+
+// PoolLeak 调试模式下未归还的对象
+type PoolLeak struct {
+	//取出位置
+	Caller string
+	//取出时的容量
+	Cap int
+}
+
+// Stats 统计快照
+func (p *Pool) Stats() PoolStats {
+	s := PoolStats{
+		Allocs:       atomic.LoadInt64(&p.allocs),
+		Misses:       atomic.LoadInt64(&p.misses),
+		Frees:        atomic.LoadInt64(&p.frees),
+		Dropped:      atomic.LoadInt64(&p.dropped),
+		Calibrations: atomic.LoadInt64(&p.calibrations),
+		DefaultSize:  atomic.LoadInt64(&p.defaultSize),
+	}
+	p.debugMutex.Lock()
+	s.Outstanding = len(p.outstanding)
+	p.debugMutex.Unlock()
+	return s
+}
+
+// SetDebug 开关调试模式，开启后记录每次取出的位置，重复归还或归还非本池对象时调用report
+// 需在使用前开启，否则开启前取出的对象归还时会被误报
+func (p *Pool) SetDebug(on bool, report func(error)) {
+	p.debugMutex.Lock()
+	defer p.debugMutex.Unlock()
+	if on {
+		p.outstanding = make(map[any]PoolLeak)
+		p.report = report
+		atomic.StoreInt32(&p.debug, 1)
+	} else {
+		atomic.StoreInt32(&p.debug, 0)
+		p.outstanding = nil
+		p.report = nil
+	}
+}
+
+// Leaks 调试模式下取出后尚未归还的对象
+func (p *Pool) Leaks() []PoolLeak {
+	p.debugMutex.Lock()
+	defer p.debugMutex.Unlock()
+	var l []PoolLeak
+	for _, v := range p.outstanding {
+		l = append(l, v)
+	}
+	return l
+}
+
+// callerSite 调用位置，格式同 WrapStack
+func callerSite(skip int) string {
+	_, f, l, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s:%d", f[strings.LastIndex(f, "/")+1:], l)
+}
+
+// track 调试模式下记录取出位置，skip 为相对调用者的层数
+func (p *Pool) track(x any, skip int) {
+	if atomic.LoadInt32(&p.debug) == 0 {
+		return
+	}
+	leak := PoolLeak{Caller: callerSite(skip + 1)}
+	//取出时记录容量，之后对象归使用者所有
+	switch v := x.(type) {
+	case *[]byte:
+		leak.Cap = cap(*v)
+	case *bytes.Buffer:
+		leak.Cap = v.Cap()
+	}
+	p.debugMutex.Lock()
+	if p.outstanding != nil {
+		p.outstanding[x] = leak
+	}
+	p.debugMutex.Unlock()
+}
+
+// untrack 调试模式下核对归还，返回false表示重复归还或非本池对象
+func (p *Pool) untrack(x any, skip int) bool {
+	if atomic.LoadInt32(&p.debug) == 0 {
+		return true
+	}
+	p.debugMutex.Lock()
+	if p.outstanding == nil {
+		p.debugMutex.Unlock()
+		return true
+	}
+	_, ok := p.outstanding[x]
+	delete(p.outstanding, x)
+	report := p.report
+	p.debugMutex.Unlock()
+	if !ok && report != nil {
+		report(fmt.Errorf("[%s] double free or foreign object", callerSite(skip+1)))
+	}
+	return ok
+}
+
+// sizeClass 容量不小于n的最小级别，poolSteps 表示不入池
+func sizeClass(n int) int {
+	if n <= int(minBitSize) {
+		return Log2Up(uint32(minBitSize))
+	}
+	//避免转换 uint32 时截断
+	if n > 1<<(poolSteps-1) {
+		return poolSteps
+	}
+	return Log2Up(uint32(n-1)) + 1
+}
+
+// capClass 容量c所属级别，-1 表示不入池
+func capClass(c int) int {
+	if c < int(minBitSize) || c >= 1<<poolSteps {
+		return -1
+	}
+	return Log2Up(uint32(c))
+}
+
+func (p *Pool) allocSlice(idx int) *[]byte {
+	atomic.AddInt64(&p.allocs, 1)
+	v := p.slicePools[idx].Get()
 	if v != nil {
 		return v.(*[]byte)
 	}
-	b := make([]byte, 0, max(atomic.LoadInt64(&p.defaultSize), minBitSize))
+	atomic.AddInt64(&p.misses, 1)
+	b := make([]byte, 0, 1<<idx)
+	return &b
+}
+
+func (p *Pool) allocBuffer(idx int) *bytes.Buffer {
+	atomic.AddInt64(&p.allocs, 1)
+	v := p.bufferPools[idx].Get()
+	if v != nil {
+		return v.(*bytes.Buffer)
+	}
+	atomic.AddInt64(&p.misses, 1)
+	b := make([]byte, 0, 1<<idx)
+	return bytes.NewBuffer(b)
+}
+
+// AllocSlice 取出容量不小于校准值的切片
+func (p *Pool) AllocSlice() *[]byte {
+	b := p.allocSlice(sizeClass(int(atomic.LoadInt64(&p.defaultSize))))
+	p.track(b, 1)
+	return b
+}
+
+func (p *Pool) allocSliceN(n int) *[]byte {
+	p.record(n)
+	if idx := sizeClass(n); idx < poolSteps {
+		return p.allocSlice(idx)
+	}
+	atomic.AddInt64(&p.allocs, 1)
+	atomic.AddInt64(&p.misses, 1)
+	b := make([]byte, 0, n)
 	return &b
 }
+
+// AllocSliceN 取出容量不小于n的切片，n计入校准统计
+func (p *Pool) AllocSliceN(n int) *[]byte {
+	b := p.allocSliceN(n)
+	p.track(b, 1)
+	return b
+}
+
+// FreeSlice 归还切片，长度计入校准统计
 func (p *Pool) FreeSlice(x *[]byte) {
-	idx := Log2Up(uint32(len(*x)))
-	if atomic.AddInt64(&p.array[idx], 1) > calibrateCallsThreshold {
-		p.calibrate()
+	if !p.untrack(x, 1) {
+		return
 	}
+	atomic.AddInt64(&p.frees, 1)
+	p.record(len(*x))
 	// 重置切片长度为 0
 	*x = (*x)[:0]
-	n := atomic.LoadInt64(&p.defaultSize)
-	if n == 0 || cap(*x) <= int(n) {
-		p.slicePool.Put(x)
+	if c := capClass(cap(*x)); c > -1 {
+		p.slicePools[c].Put(x)
+	} else {
+		atomic.AddInt64(&p.dropped, 1)
 	}
 }
 
+// AllocBuffer 取出容量不小于校准值的Buffer
 func (p *Pool) AllocBuffer() *bytes.Buffer {
-	v := p.byteBufferPool.Get()
-	if v != nil {
-		return v.(*bytes.Buffer)
+	b := p.allocBuffer(sizeClass(int(atomic.LoadInt64(&p.defaultSize))))
+	p.track(b, 1)
+	return b
+}
+
+// AllocBufferN 取出容量不小于n的Buffer，n计入校准统计
+func (p *Pool) AllocBufferN(n int) *bytes.Buffer {
+	p.record(n)
+	var b *bytes.Buffer
+	if idx := sizeClass(n); idx < poolSteps {
+		b = p.allocBuffer(idx)
+	} else {
+		atomic.AddInt64(&p.allocs, 1)
+		atomic.AddInt64(&p.misses, 1)
+		b = bytes.NewBuffer(make([]byte, 0, n))
 	}
-	b := make([]byte, 0, max(atomic.LoadInt64(&p.defaultSize), minBitSize))
-	return bytes.NewBuffer(b)
+	p.track(b, 1)
+	return b
 }
 
+// FreeBuffer 归还Buffer，长度计入校准统计
 func (p *Pool) FreeBuffer(x *bytes.Buffer) {
-	idx := Log2Up(uint32(x.Len()))
-	if atomic.AddInt64(&p.array[idx], 1) > calibrateCallsThreshold {
-		p.calibrate()
+	if !p.untrack(x, 1) {
+		return
 	}
+	atomic.AddInt64(&p.frees, 1)
+	p.record(x.Len())
 	// 重置 Buffer
 	x.Reset()
-	n := atomic.LoadInt64(&p.defaultSize)
-	if n == 0 || x.Cap() <= int(n) {
-		p.byteBufferPool.Put(x)
+	if c := capClass(x.Cap()); c > -1 {
+		p.bufferPools[c].Put(x)
+	} else {
+		atomic.AddInt64(&p.dropped, 1)
+	}
+}
+
+// SharedBuffer 引用计数的池化切片，用于一份数据交给多个写者的场景
+// 计数归零时切片归还 Pool，之后不可再访问
+type SharedBuffer struct {
+	pool *Pool
+	buf  *[]byte
+	refs int32
+}
+
+// AllocShared 取出容量不小于n的共享切片，初始引用计数为1
+func (p *Pool) AllocShared(n int) *SharedBuffer {
+	b := p.allocSliceN(n)
+	p.track(b, 1)
+	return &SharedBuffer{pool: p, buf: b, refs: 1}
+}
+
+// Write 追加数据，应在分享给其他写者之前完成
+func (s *SharedBuffer) Write(b []byte) (int, error) {
+	*s.buf = append(*s.buf, b...)
+	return len(b), nil
+}
+
+// Bytes 数据，Release 后不可再使用
+func (s *SharedBuffer) Bytes() []byte {
+	return *s.buf
+}
+
+// Retain 引用计数加一，每次 Retain 须对应一次 Release
+func (s *SharedBuffer) Retain() *SharedBuffer {
+	if atomic.AddInt32(&s.refs, 1) < 2 {
+		panic("SharedBuffer.Retain: 已释放")
+	}
+	return s
+}
+
+// Release 引用计数减一，归零时归还 Pool
+func (s *SharedBuffer) Release() {
+	n := atomic.AddInt32(&s.refs, -1)
+	if n > 0 {
+		return
+	}
+	if n < 0 {
+		panic("SharedBuffer.Release: 重复释放")
+	}
+	s.pool.FreeSlice(s.buf)
+}
+
+// RefCount 当前引用计数
+func (s *SharedBuffer) RefCount() int32 {
+	return atomic.LoadInt32(&s.refs)
+}
+
+// calibrator 按长度直方图自校准默认容量，取覆盖九成样本的2的幂
+type calibrator struct {
+	array [poolSteps]int64
+	//Padding
+	_           [7]int64
+	calibrating int64
+	//Padding
+	_            [7]int64
+	defaultSize  int64
+	calibrations int64
+}
+
+// record 记录长度到统计直方图，达到阈值后校准
+func (c *calibrator) record(n int) {
+	idx := poolSteps - 1
+	if n < 1<<poolSteps {
+		idx = Log2Up(uint32(max(n, 0)))
+	}
+	if atomic.AddInt64(&c.array[idx], 1) > calibrateCallsThreshold {
+		c.calibrate()
 	}
 }
 
 // 校准操作
-func (p *Pool) calibrate() {
+func (c *calibrator) calibrate() {
 	// 避免并发
-	if !atomic.CompareAndSwapInt64(&p.calibrating, 0, 1) {
+	if !atomic.CompareAndSwapInt64(&c.calibrating, 0, 1) {
 		return
 	}
 	var list [poolSteps]int64
 	var total, sum int64
 	// 读出总数
 	for i := range poolSteps {
-		list[i] = atomic.SwapInt64(&p.array[i], 0)
+		list[i] = atomic.SwapInt64(&c.array[i], 0)
 		total += list[i]
 	}
 	total = total * 9 / 10
@@ -95,8 +372,9 @@ func (p *Pool) calibrate() {
 	}
 	// fmt.Println(pos, list)
 	// 保存对应值
-	atomic.StoreInt64(&p.defaultSize, max(1<<pos, minBitSize))
-	atomic.StoreInt64(&p.calibrating, 0)
+	atomic.StoreInt64(&c.defaultSize, max(1<<pos, minBitSize))
+	atomic.AddInt64(&c.calibrations, 1)
+	atomic.StoreInt64(&c.calibrating, 0)
 }
 
 // Log2Up 取上一个2的对数
@@ -1,8 +1,13 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -20,6 +25,139 @@ func TestLog2Up(t *testing.T) {
 	}
 }
 
+func TestSizeClass(t *testing.T) {
+	var tests = []struct {
+		arg       int
+		size, cap int
+	}{
+		{0, 6, -1}, {63, 6, -1}, {64, 6, 6}, {65, 7, 6}, {127, 7, 6}, {128, 7, 7}, {1 << 25, 25, 25}, {1<<25 + 1, 26, 25}, {1 << 26, 26, -1}, {math.MaxInt, 26, -1},
+	}
+	for i := range tests {
+		if sizeClass(tests[i].arg) != tests[i].size || capClass(tests[i].arg) != tests[i].cap {
+			t.Fatal(i, tests[i].arg, sizeClass(tests[i].arg), capClass(tests[i].arg))
+		}
+	}
+}
+
+func TestPoolTiered(t *testing.T) {
+	p := &Pool{}
+	// 竞态检测下sync.Pool会随机丢弃对象，多次尝试
+	pooled := func(c, size int) bool {
+		for range 100 {
+			x := make([]byte, 0, size)
+			p.FreeSlice(&x)
+			if v := p.slicePools[c].Get(); v != nil {
+				return cap(*v.(*[]byte)) == size
+			}
+		}
+		return false
+	}
+	if !pooled(16, 64*1024) {
+		t.Fatal("large slice not pooled")
+	}
+	if !pooled(6, 100) {
+		t.Fatal("small slice not pooled")
+	}
+	atomic.StoreInt64(&p.defaultSize, 8192)
+	if b := p.AllocBuffer(); b.Cap() < 8192 {
+		t.Fatal(b.Cap())
+	}
+}
+
+func TestAllocN(t *testing.T) {
+	p := &Pool{}
+	for _, n := range []int{0, 1, 64, 100, 32 * 1024, 1<<25 + 1} {
+		b := p.AllocSliceN(n)
+		if cap(*b) < n || len(*b) != 0 {
+			t.Fatal(n, cap(*b))
+		}
+		p.FreeSlice(b)
+		buf := p.AllocBufferN(n)
+		if buf.Cap() < n || buf.Len() != 0 {
+			t.Fatal(n, buf.Cap())
+		}
+		p.FreeBuffer(buf)
+	}
+	// 提示长度计入统计
+	q := &Pool{}
+	for range calibrateCallsThreshold + 1 {
+		q.FreeSlice(q.AllocSliceN(32 * 1024))
+	}
+	if n := atomic.LoadInt64(&q.defaultSize); n < 16*1024 {
+		t.Fatal(n)
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	p := &Pool{}
+	b := p.AllocSlice()
+	p.FreeSlice(b)
+	huge := make([]byte, 0, 1<<poolSteps)
+	p.FreeSlice(&huge)
+	s := p.Stats()
+	if s.Allocs != 1 || s.Misses != 1 || s.Frees != 2 || s.Dropped != 1 {
+		t.Fatalf("%+v", s)
+	}
+}
+
+func TestPoolDebug(t *testing.T) {
+	p := &Pool{}
+	var reported []error
+	p.SetDebug(true, func(err error) { reported = append(reported, err) })
+	a := p.AllocSlice()
+	b := p.AllocBufferN(1024)
+	p.FreeSlice(a)
+	p.FreeSlice(a)
+	if len(reported) != 1 || !strings.Contains(reported[0].Error(), "pool_test.go") {
+		t.Fatal(reported)
+	}
+	//记录取出时的容量
+	c := b.Cap()
+	b.Write(make([]byte, 4*c))
+	leaks := p.Leaks()
+	if len(leaks) != 1 || !strings.Contains(leaks[0].Caller, "pool_test.go") || leaks[0].Cap != c || c < 1024 {
+		t.Fatal(leaks)
+	}
+	if s := p.Stats(); s.Outstanding != 1 || s.Frees != 1 {
+		t.Fatalf("%+v", s)
+	}
+	p.FreeBuffer(b)
+	if len(p.Leaks()) != 0 {
+		t.Fatal(p.Leaks())
+	}
+	p.SetDebug(false, nil)
+}
+
+func TestSharedBuffer(t *testing.T) {
+	p := &Pool{}
+	msg := []byte("broadcast message")
+	s := p.AllocShared(len(msg))
+	s.Write(msg)
+	var wg sync.WaitGroup
+	for range 64 {
+		s.Retain()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer s.Release()
+			if !bytes.Equal(s.Bytes(), msg) {
+				t.Error(string(s.Bytes()))
+			}
+		}()
+	}
+	s.Release()
+	wg.Wait()
+	if s.RefCount() != 0 || p.Stats().Frees != 1 {
+		t.Fatal(s.RefCount(), p.Stats())
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	s.Release()
+}
+
 func TestPool(t *testing.T) {
 	p := &Pool{}
 	for i := range 10000 {
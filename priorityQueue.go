@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// heapSlice 以less比较的小顶堆，实现 heap.Interface
+type heapSlice[T any] struct {
+	items []T
+	less  func(a, b T) bool
+}
+
+func (h *heapSlice[T]) Len() int           { return len(h.items) }
+func (h *heapSlice[T]) Less(i, j int) bool { return h.less(h.items[i], h.items[j]) }
+func (h *heapSlice[T]) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *heapSlice[T]) Push(x any)         { h.items = append(h.items, x.(T)) }
+func (h *heapSlice[T]) Pop() any {
+	n := len(h.items)
+	item := h.items[n-1]
+	// 便于GC回收
+	var zero T
+	h.items[n-1] = zero
+	h.items = h.items[:n-1]
+	return item
+}
+
+// wake 非阻塞唤醒一个等待者
+func wake(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// PriorityQueue 并发安全的优先队列，less(a, b) 为true时a先出队
+type PriorityQueue[T any] struct {
+	mutex  sync.Mutex
+	heap   heapSlice[T]
+	notify chan struct{}
+}
+
+// NewPriorityQueue 新建
+func NewPriorityQueue[T any](less func(a, b T) bool) *PriorityQueue[T] {
+	return &PriorityQueue[T]{
+		heap:   heapSlice[T]{less: less},
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// Push 入队
+func (q *PriorityQueue[T]) Push(v T) {
+	q.mutex.Lock()
+	heap.Push(&q.heap, v)
+	q.mutex.Unlock()
+	wake(q.notify)
+}
+
+// Peek 查看队首，不出队
+func (q *PriorityQueue[T]) Peek() (v T, ok bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.heap.Len() == 0 {
+		return v, false
+	}
+	return q.heap.items[0], true
+}
+
+// TryPop 出队，队列空时返回false
+func (q *PriorityQueue[T]) TryPop() (v T, ok bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.heap.Len() == 0 {
+		return v, false
+	}
+	v = heap.Pop(&q.heap).(T)
+	if q.heap.Len() > 0 {
+		// 唤醒其他等待者
+		wake(q.notify)
+	}
+	return v, true
+}
+
+// Pop 出队，队列空时等待，直到ctx结束
+func (q *PriorityQueue[T]) Pop(ctx context.Context) (T, error) {
+	for {
+		if v, ok := q.TryPop(); ok {
+			return v, nil
+		}
+		select {
+		case <-q.notify:
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// Len 长度
+func (q *PriorityQueue[T]) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.heap.Len()
+}
+
+type delayItem[T any] struct {
+	deadline time.Time
+	value    T
+}
+
+// DelayQueue 并发安全的延迟队列，元素到期后才能取出，按到期时间先后出队
+type DelayQueue[T any] struct {
+	mutex  sync.Mutex
+	heap   heapSlice[delayItem[T]]
+	notify chan struct{}
+}
+
+// NewDelayQueue 新建
+func NewDelayQueue[T any]() *DelayQueue[T] {
+	return &DelayQueue[T]{
+		heap: heapSlice[delayItem[T]]{less: func(a, b delayItem[T]) bool {
+			return a.deadline.Before(b.deadline)
+		}},
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// Put 加入，deadline 后可取出
+func (q *DelayQueue[T]) Put(v T, deadline time.Time) {
+	q.mutex.Lock()
+	heap.Push(&q.heap, delayItem[T]{deadline: deadline, value: v})
+	q.mutex.Unlock()
+	wake(q.notify)
+}
+
+// tryTake 取出已到期的队首，未到期时返回距到期的时间，队列空时返回-1
+func (q *DelayQueue[T]) tryTake() (v T, wait time.Duration) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.heap.Len() == 0 {
+		return v, -1
+	}
+	if wait = time.Until(q.heap.items[0].deadline); wait > 0 {
+		return v, wait
+	}
+	v = heap.Pop(&q.heap).(delayItem[T]).value
+	if q.heap.Len() > 0 {
+		wake(q.notify)
+	}
+	return v, 0
+}
+
+// TryTake 取出已到期的元素，无到期元素时返回false
+func (q *DelayQueue[T]) TryTake() (T, bool) {
+	v, wait := q.tryTake()
+	return v, wait == 0
+}
+
+// Take 取出，无到期元素时等待，直到ctx结束
+func (q *DelayQueue[T]) Take(ctx context.Context) (T, error) {
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		v, wait := q.tryTake()
+		if wait == 0 {
+			return v, nil
+		}
+		var expire <-chan time.Time
+		if wait > 0 {
+			if timer == nil {
+				timer = time.NewTimer(wait)
+			} else {
+				timer.Reset(wait)
+			}
+			expire = timer.C
+		}
+		select {
+		case <-q.notify:
+		case <-expire:
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// Len 长度，包括未到期的元素
+func (q *DelayQueue[T]) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.heap.Len()
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGenericPriorityQueue(t *testing.T) {
+	q := NewPriorityQueue(func(a, b int) bool { return a < b })
+	for _, v := range []int{5, 1, 4, 2, 3} {
+		q.Push(v)
+	}
+	if v, ok := q.Peek(); !ok || v != 1 || q.Len() != 5 {
+		t.Fatal(v, ok, q.Len())
+	}
+	var l []int
+	for {
+		v, ok := q.TryPop()
+		if !ok {
+			break
+		}
+		l = append(l, v)
+	}
+	if !reflect.DeepEqual(l, []int{1, 2, 3, 4, 5}) {
+		t.Fatal(l)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.Pop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+}
+
+func TestPriorityQueueBlockingPop(t *testing.T) {
+	q := NewPriorityQueue(func(a, b int) bool { return a < b })
+	const n = 100
+	var wg sync.WaitGroup
+	results := make(chan int, n)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range n / 4 {
+				v, err := q.Pop(context.Background())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				results <- v
+			}
+		}()
+	}
+	for i := range n {
+		q.Push(i)
+	}
+	wg.Wait()
+	if len(results) != n {
+		t.Fatal(len(results))
+	}
+}
+
+func TestDelayQueue(t *testing.T) {
+	q := NewDelayQueue[string]()
+	now := time.Now()
+	q.Put("c", now.Add(60*time.Millisecond))
+	q.Put("a", now.Add(20*time.Millisecond))
+	q.Put("b", now.Add(40*time.Millisecond))
+	if _, ok := q.TryTake(); ok {
+		t.Fatal("not due yet")
+	}
+	ctx := context.Background()
+	for _, want := range []string{"a", "b", "c"} {
+		v, err := q.Take(ctx)
+		if err != nil || v != want {
+			t.Fatal(v, err, want)
+		}
+	}
+	if elapsed := time.Since(now); elapsed < 60*time.Millisecond {
+		t.Fatal(elapsed)
+	}
+	// 等待中加入更早到期的元素
+	q.Put("late", time.Now().Add(time.Hour))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Put("early", time.Now())
+	}()
+	if v, err := q.Take(ctx); err != nil || v != "early" {
+		t.Fatal(v, err)
+	}
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.Take(cctx); !errors.Is(err, context.DeadlineExceeded) || q.Len() != 1 {
+		t.Fatal(err, q.Len())
+	}
+}
@@ -1,65 +1,281 @@
 package utils
 
 import (
+	"context"
+	"iter"
 	"runtime"
 	"slices"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // CopyOnWriteList (COW)需要修改的时候拷贝一个副本出来，适用不频繁写的场景
-// 修改时新数据原子替换旧数据地址，旧数据由GC回收。
-type CopyOnWriteList struct {
-	//0-unlock 1-lock
-	mutex int64
-	slice atomic.Value
+// 修改时新数据原子替换旧数据地址，旧数据由GC回收。读无锁，写之间用互斥锁串行。
+// 零值可直接使用
+type CopyOnWriteList[T any] struct {
+	mutex sync.Mutex
+	slice atomic.Pointer[[]T]
 }
 
 // NewCopyOnWriteList 新增
-func NewCopyOnWriteList() *CopyOnWriteList {
-	l := CopyOnWriteList{}
-	l.slice.Store([]any{})
-	return &l
+func NewCopyOnWriteList[T any]() *CopyOnWriteList[T] {
+	return &CopyOnWriteList[T]{}
+}
+
+// Update 原子地批量修改，f 收到当前数据的副本，返回值成为新数据
+func (l *CopyOnWriteList[T]) Update(f func([]T) []T) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	data := f(slices.Clone(l.List()))
+	l.slice.Store(&data)
 }
 
 // Add 增加
-func (l *CopyOnWriteList) Add(element any) {
-	for {
-		if atomic.CompareAndSwapInt64(&l.mutex, 0, 1) {
-			base := l.slice.Load().([]any)
-			data := slices.Clone(base)
-			data = append(data, element)
-			l.slice.Store(data)
-			atomic.StoreInt64(&l.mutex, 0)
+func (l *CopyOnWriteList[T]) Add(element T) {
+	l.Update(func(data []T) []T {
+		return append(data, element)
+	})
+}
+
+// Remove 移除
+func (l *CopyOnWriteList[T]) Remove(judge func(T) bool) {
+	l.Update(func(data []T) []T {
+		return slices.DeleteFunc(data, judge)
+	})
+}
+
+// Replace 整体替换为data的副本
+func (l *CopyOnWriteList[T]) Replace(data []T) {
+	data = slices.Clone(data)
+	l.mutex.Lock()
+	l.slice.Store(&data)
+	l.mutex.Unlock()
+}
+
+// List 列，返回当前快照，不要修改
+func (l *CopyOnWriteList[T]) List() []T {
+	if p := l.slice.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// Len 长度
+func (l *CopyOnWriteList[T]) Len() int {
+	return len(l.List())
+}
+
+// Range 遍历当前快照，f 返回false时停止
+func (l *CopyOnWriteList[T]) Range(f func(int, T) bool) {
+	for i, v := range l.List() {
+		if !f(i, v) {
 			return
 		}
-		runtime.Gosched()
 	}
 }
 
-// Remove 移除
-func (l *CopyOnWriteList) Remove(judge func(any) bool) {
+// All 迭代当前快照
+func (l *CopyOnWriteList[T]) All() iter.Seq[T] {
+	return slices.Values(l.List())
+}
+
+type ringSlot[T any] struct {
+	//序号，等于位置时可写入，等于位置+1时可读出
+	sequence uint64
+	value    T
+}
+
+// RingQueue 有界多生产者多消费者无锁环形队列（Vyukov 算法）
+type RingQueue[T any] struct {
+	//Padding
+	_       [8]uint64
+	enqueue uint64
+	//Padding
+	_       [7]uint64
+	dequeue uint64
+	//Padding
+	_     [7]uint64
+	mask  uint64
+	slots []ringSlot[T]
+}
+
+// NewRingQueue 新建，容量向上取2的幂
+func NewRingQueue[T any](size int) *RingQueue[T] {
+	n := 2
+	for n < size {
+		n <<= 1
+	}
+	q := &RingQueue[T]{
+		mask:  uint64(n - 1),
+		slots: make([]ringSlot[T], n),
+	}
+	for i := range q.slots {
+		q.slots[i].sequence = uint64(i)
+	}
+	return q
+}
+
+// TryPut 写入，队列满时返回false
+func (q *RingQueue[T]) TryPut(v T) bool {
+	pos := atomic.LoadUint64(&q.enqueue)
 	for {
-		if atomic.CompareAndSwapInt64(&l.mutex, 0, 1) {
-			base := l.slice.Load().([]any)
-			data := make([]any, 0, len(base))
-			for _, item := range base {
-				if !judge(item) {
-					data = append(data, item)
-				}
+		slot := &q.slots[pos&q.mask]
+		seq := atomic.LoadUint64(&slot.sequence)
+		switch dif := int64(seq - pos); {
+		case dif == 0:
+			if atomic.CompareAndSwapUint64(&q.enqueue, pos, pos+1) {
+				slot.value = v
+				atomic.StoreUint64(&slot.sequence, pos+1)
+				return true
 			}
-			l.slice.Store(data)
-			atomic.StoreInt64(&l.mutex, 0)
-			return
+			pos = atomic.LoadUint64(&q.enqueue)
+		case dif < 0:
+			return false
+		default:
+			pos = atomic.LoadUint64(&q.enqueue)
 		}
+	}
+}
+
+// TryGet 读出，队列空时返回false
+func (q *RingQueue[T]) TryGet() (v T, ok bool) {
+	pos := atomic.LoadUint64(&q.dequeue)
+	for {
+		slot := &q.slots[pos&q.mask]
+		seq := atomic.LoadUint64(&slot.sequence)
+		switch dif := int64(seq - (pos + 1)); {
+		case dif == 0:
+			if atomic.CompareAndSwapUint64(&q.dequeue, pos, pos+1) {
+				v = slot.value
+				var zero T
+				slot.value = zero
+				atomic.StoreUint64(&slot.sequence, pos+q.mask+1)
+				return v, true
+			}
+			pos = atomic.LoadUint64(&q.dequeue)
+		case dif < 0:
+			return v, false
+		default:
+			pos = atomic.LoadUint64(&q.dequeue)
+		}
+	}
+}
+
+// backoff 先让出CPU，多次失败后休眠，最长1ms
+func backoff(count int) {
+	if count < 16 {
 		runtime.Gosched()
+		return
+	}
+	time.Sleep(min(time.Duration(count-15)*time.Microsecond, time.Millisecond))
+}
+
+// Put 写入，队列满时等待，直到ctx结束
+func (q *RingQueue[T]) Put(ctx context.Context, v T) error {
+	for count := 0; ; count++ {
+		if q.TryPut(v) {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		backoff(count)
 	}
 }
 
-// List 列
-func (l *CopyOnWriteList) List() []any {
-	return l.slice.Load().([]any)
+// Get 读出，队列空时等待，直到ctx结束
+func (q *RingQueue[T]) Get(ctx context.Context) (T, error) {
+	for count := 0; ; count++ {
+		if v, ok := q.TryGet(); ok {
+			return v, nil
+		}
+		if err := ctx.Err(); err != nil {
+			var zero T
+			return zero, err
+		}
+		backoff(count)
+	}
+}
+
+// Len 当前元素数，并发下为近似值
+func (q *RingQueue[T]) Len() int {
+	n := int64(atomic.LoadUint64(&q.enqueue) - atomic.LoadUint64(&q.dequeue))
+	return int(min(max(n, 0), int64(q.mask+1)))
+}
+
+// Cap 容量
+func (q *RingQueue[T]) Cap() int {
+	return int(q.mask + 1)
+}
+
+type mpscNode[T any] struct {
+	next  atomic.Pointer[mpscNode[T]]
+	value T
+}
+
+// MPSCQueue 无界多生产者单消费者无锁链表队列（Vyukov 算法），写入永不阻塞
+// 消费者在 Notify 返回的通道上等待唤醒，被唤醒后用 Pop 取空队列
+type MPSCQueue[T any] struct {
+	//生产者端
+	head atomic.Pointer[mpscNode[T]]
+	//Padding
+	_ [7]int64
+	//消费者端，仅消费者访问
+	tail   *mpscNode[T]
+	length int64
+	notify chan struct{}
+}
+
+// NewMPSCQueue 新建
+func NewMPSCQueue[T any]() *MPSCQueue[T] {
+	stub := &mpscNode[T]{}
+	q := &MPSCQueue[T]{
+		tail:   stub,
+		notify: make(chan struct{}, 1),
+	}
+	q.head.Store(stub)
+	return q
+}
+
+// Push 写入，可多协程并发调用
+func (q *MPSCQueue[T]) Push(v T) {
+	n := &mpscNode[T]{value: v}
+	atomic.AddInt64(&q.length, 1)
+	prev := q.head.Swap(n)
+	prev.next.Store(n)
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Pop 读出，队列空时返回false，只能由单个消费者协程调用
+func (q *MPSCQueue[T]) Pop() (v T, ok bool) {
+	next := q.tail.next.Load()
+	if next == nil {
+		return v, false
+	}
+	q.tail = next
+	v = next.value
+	var zero T
+	next.value = zero
+	atomic.AddInt64(&q.length, -1)
+	return v, true
+}
+
+// Notify 唤醒通道，Push 后可读
+func (q *MPSCQueue[T]) Notify() <-chan struct{} {
+	return q.notify
+}
+
+// Len 当前元素数，并发下为近似值
+func (q *MPSCQueue[T]) Len() int {
+	return int(atomic.LoadInt64(&q.length))
 }
 
+// https://www.1024cores.net/home/lock-free-algorithms/queues/non-intrusive-mpsc-node-based-queue
+// https://www.1024cores.net/home/lock-free-algorithms/queues/bounded-mpmc-queue
 // https://github.com/yireyun/go-queue
 // https://github.com/Workiva/go-datastructures
 // https://www.jianshu.com/p/231caf90f30b
@@ -1,18 +1,26 @@
 package utils
 
 import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type lockListTemp struct {
 	i int
 }
 
-func (l lockListTemp) equal(obj any) bool {
-	return l.i == obj.(lockListTemp).i
+func (l lockListTemp) equal(obj lockListTemp) bool {
+	return l.i == obj.i
 }
 func TestCopyOnWriteList(t *testing.T) {
-	l := NewCopyOnWriteList()
+	l := NewCopyOnWriteList[lockListTemp]()
 	for i := range 10 {
 		l.Add(lockListTemp{i})
 	}
@@ -33,14 +41,53 @@ func TestCopyOnWriteList(t *testing.T) {
 			t.Fatal(v, temp)
 		}
 		for i := range temp {
-			if v.result[i] != temp[i].(lockListTemp).i {
+			if v.result[i] != temp[i].i {
 				t.Fatal(i, v, temp)
 			}
 		}
 	}
 }
+func TestCopyOnWriteListUpdate(t *testing.T) {
+	var l CopyOnWriteList[int]
+	if l.Len() != 0 || l.List() != nil {
+		t.Fatal(l.List())
+	}
+	src := []int{3, 1, 2}
+	l.Replace(src)
+	src[0] = 100
+	snapshot := l.List()
+	l.Update(func(data []int) []int {
+		slices.Sort(data)
+		return append(data, 4)
+	})
+	if !reflect.DeepEqual(snapshot, []int{3, 1, 2}) || !reflect.DeepEqual(slices.Collect(l.All()), []int{1, 2, 3, 4}) {
+		t.Fatal(snapshot, l.List())
+	}
+	var visited []int
+	l.Range(func(i, v int) bool {
+		visited = append(visited, v)
+		return i < 1
+	})
+	if !reflect.DeepEqual(visited, []int{1, 2}) {
+		t.Fatal(visited)
+	}
+	var wg sync.WaitGroup
+	for i := range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Add(i)
+			_ = l.Len()
+		}()
+	}
+	wg.Wait()
+	if l.Len() != 104 {
+		t.Fatal(l.Len())
+	}
+}
+
 func BenchmarkCopyOnWriteList(b *testing.B) {
-	l := NewCopyOnWriteList()
+	l := NewCopyOnWriteList[lockListTemp]()
 	for i := range 10 {
 		l.Add(lockListTemp{i})
 	}
@@ -49,3 +96,158 @@ func BenchmarkCopyOnWriteList(b *testing.B) {
 		_ = l.List()
 	}
 }
+
+func TestRingQueue(t *testing.T) {
+	q := NewRingQueue[int](3)
+	if q.Cap() != 4 {
+		t.Fatal(q.Cap())
+	}
+	for i := range 4 {
+		if !q.TryPut(i) {
+			t.Fatal(i)
+		}
+	}
+	if q.TryPut(4) || q.Len() != 4 {
+		t.Fatal("expected full", q.Len())
+	}
+	for i := range 4 {
+		if v, ok := q.TryGet(); !ok || v != i {
+			t.Fatal(i, v, ok)
+		}
+	}
+	if _, ok := q.TryGet(); ok {
+		t.Fatal("expected empty")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+}
+
+func TestRingQueueConcurrent(t *testing.T) {
+	q := NewRingQueue[int](64)
+	const producers, consumers, count = 4, 4, 10000
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for p := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range count {
+				if err := q.Put(ctx, p*count+i); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	var sum int64
+	var cwg sync.WaitGroup
+	for range consumers {
+		cwg.Add(1)
+		go func() {
+			defer cwg.Done()
+			for range producers * count / consumers {
+				v, err := q.Get(ctx)
+				if err != nil {
+					t.Error(err)
+				}
+				atomic.AddInt64(&sum, int64(v))
+			}
+		}()
+	}
+	wg.Wait()
+	cwg.Wait()
+	n := int64(producers * count)
+	if sum != n*(n-1)/2 {
+		t.Fatal(sum)
+	}
+}
+
+func BenchmarkRingQueue(b *testing.B) {
+	q := NewRingQueue[int](1024)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			for !q.TryPut(1) {
+				runtime.Gosched()
+			}
+			for {
+				if _, ok := q.TryGet(); ok {
+					break
+				}
+				runtime.Gosched()
+			}
+		}
+	})
+}
+
+func BenchmarkChannel(b *testing.B) {
+	c := make(chan int, 1024)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c <- 1
+			<-c
+		}
+	})
+}
+
+func TestMPSCQueue(t *testing.T) {
+	q := NewMPSCQueue[int]()
+	const producers, count = 8, 10000
+	for p := range producers {
+		go func() {
+			for i := range count {
+				q.Push(p*count + i)
+			}
+		}()
+	}
+	var sum, n int64
+	last := make([]int, producers)
+	for i := range last {
+		last[i] = -1
+	}
+	for n < producers*count {
+		<-q.Notify()
+		for {
+			v, ok := q.Pop()
+			if !ok {
+				break
+			}
+			// 同一生产者内保持顺序
+			if v%count <= last[v/count] {
+				t.Fatal(v, last[v/count])
+			}
+			last[v/count] = v % count
+			sum += int64(v)
+			n++
+		}
+	}
+	if sum != n*(n-1)/2 || q.Len() != 0 {
+		t.Fatal(sum, q.Len())
+	}
+}
+
+func BenchmarkMPSCQueue(b *testing.B) {
+	q := NewMPSCQueue[int]()
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-q.Notify():
+				for {
+					if _, ok := q.Pop(); !ok {
+						break
+					}
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			q.Push(1)
+		}
+	})
+	close(done)
+}
@@ -1,12 +1,47 @@
 package utils
 
 import (
+	"context"
 	"errors"
+	"math"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
-// Limiter 限流器 Token Bucket(令牌桶)
+// Limiter 限流器
+type Limiter interface {
+	//申请1个令牌，成功返回true
+	Allow() bool
+	//申请n个令牌，取不到时立即返回错误
+	Take(n int64) error
+	//申请n个令牌，不足时阻塞等待，直到ctx结束
+	Wait(ctx context.Context, n int64) error
+}
+
+var (
+	_ Limiter = (*TokenBucketLimiter)(nil)
+	_ Limiter = (*SlidingWindowLimiter)(nil)
+	_ Limiter = (*LeakyBucketLimiter)(nil)
+	_ Limiter = (*DistributedLimiter)(nil)
+)
+
+// sleepContext 等待d，ctx先结束时返回其错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TokenBucketLimiter 限流器 Token Bucket(令牌桶)
 // 每隔一段时间加入一批令牌，达到上限后，不再增加。
 type TokenBucketLimiter struct {
 	//限流器速率，每秒处理的令牌数
@@ -21,6 +56,19 @@ type TokenBucketLimiter struct {
 	tokens int64
 	//退出标志 1-退出
 	stopFlag int32
+	//惰性补充模式，上次补充的单调时钟纳秒数
+	lazy bool
+	last int64
+	//时钟，nil 为系统时钟
+	clock Clock
+}
+
+// 单调时钟基准
+var monotonicBase = time.Now()
+
+// monotonicNow 单调时钟纳秒数，不受系统时间调整影响
+func monotonicNow() int64 {
+	return int64(time.Since(monotonicBase))
 }
 
 // NewTokenBucketLimiter limitRate, limitSize,snippet数值较小时，准确度低。
@@ -39,11 +87,80 @@ func NewTokenBucketLimiter(limitRate, limitSize int64, snippet time.Duration) *T
 	return t
 }
 
-// Wait 等待,申请n个令牌，取不到足够数量时返回错误。
+// NewLazyTokenBucketLimiter 惰性补充的限流器，在 Take 时按经过的单调时间计算补充的令牌，
+// 无需 Run 或 Task，不占用协程和定时器，适合大量限流器并存的场景。
+func NewLazyTokenBucketLimiter(limitRate, limitSize int64, snippet time.Duration) *TokenBucketLimiter {
+	t := NewTokenBucketLimiter(limitRate, limitSize, snippet)
+	t.lazy = true
+	t.last = monotonicNow()
+	return t
+}
+
+// SetClock 设置时钟，用于惰性补充及预约等待，须在使用前设置
+// Run 仍按实际时间补充，测试中可手动调用 Task
+func (t *TokenBucketLimiter) SetClock(c Clock) *TokenBucketLimiter {
+	t.clock = c
+	atomic.StoreInt64(&t.last, t.nanotime())
+	return t
+}
+
+// nanotime 惰性补充使用的纳秒数，系统时钟下为单调时钟
+func (t *TokenBucketLimiter) nanotime() int64 {
+	if t.clock == nil {
+		return monotonicNow()
+	}
+	return int64(t.clock.Now().Sub(monotonicBase))
+}
+
+// advance 惰性模式下按经过时间补充令牌，不足一个令牌的时间留待下次累计
+func (t *TokenBucketLimiter) advance() {
+	if t.LimitRate <= 0 {
+		return
+	}
+	now := t.nanotime()
+	last := atomic.LoadInt64(&t.last)
+	elapsed := now - last
+	snippet := int64(t.Snippet)
+	//补满所需时间，超过后无需精确计算，同时避免溢出
+	fill := (t.LimitSize*snippet + t.LimitRate - 1) / t.LimitRate
+	var add, next int64
+	full := elapsed >= fill
+	if full {
+		add, next = t.LimitSize, now
+	} else {
+		add = elapsed * t.LimitRate / snippet
+		if add <= 0 {
+			return
+		}
+		next = last + add*snippet/t.LimitRate
+	}
+	if !atomic.CompareAndSwapInt64(&t.last, last, next) {
+		//其他协程已补充
+		return
+	}
+	if full {
+		//长时间空闲后补满，不叠加到可能为负的余额上
+		atomic.StoreInt64(&t.tokens, t.LimitSize)
+		return
+	}
+	if atomic.AddInt64(&t.tokens, add) > t.LimitSize {
+		for {
+			cur := atomic.LoadInt64(&t.tokens)
+			if cur <= t.LimitSize || atomic.CompareAndSwapInt64(&t.tokens, cur, t.LimitSize) {
+				break
+			}
+		}
+	}
+}
+
+// Take 申请n个令牌，取不到足够数量时立即返回错误。
 func (t *TokenBucketLimiter) Take(n int64) error {
 	if atomic.LoadInt32(&t.stopFlag) == 1 {
 		return nil
 	}
+	if t.lazy {
+		t.advance()
+	}
 	new := atomic.AddInt64(&t.tokens, -n)
 	if new > -1 {
 		return nil
@@ -52,36 +169,136 @@ func (t *TokenBucketLimiter) Take(n int64) error {
 	return errors.New("rate limit")
 }
 
+// refill 补充一批令牌，不超过上限。预约产生的欠额（负值）需逐批偿还，不予清零。
+func (t *TokenBucketLimiter) refill() {
+	//竟态下，牺牲准确度。
+	new := atomic.AddInt64(&t.tokens, t.LimitRate)
+	if new > t.LimitSize {
+		atomic.StoreInt64(&t.tokens, t.LimitSize)
+	}
+}
+
+// Run 定时补充令牌，惰性模式下直接返回
 func (t *TokenBucketLimiter) Run() {
+	if t.lazy {
+		return
+	}
 	for {
 		if atomic.LoadInt32(&t.stopFlag) == 1 {
 			return
 		}
 		time.Sleep(t.Snippet)
-		//竟态下，牺牲准确度。
-		new := atomic.AddInt64(&t.tokens, t.LimitRate)
-		if new > t.LimitSize {
-			atomic.StoreInt64(&t.tokens, t.LimitSize)
-		}
-		if new < t.LimitRate {
-			atomic.StoreInt64(&t.tokens, t.LimitRate)
-		}
+		t.refill()
 	}
 }
 
+// Task 补充一批令牌，返回下次执行间隔，可加入 Timing 运行，惰性模式下返回0
 func (t *TokenBucketLimiter) Task() time.Duration {
-	if atomic.LoadInt32(&t.stopFlag) == 1 {
+	if atomic.LoadInt32(&t.stopFlag) == 1 || t.lazy {
 		return 0
 	}
-	//竟态下，牺牲准确度。
-	new := atomic.AddInt64(&t.tokens, t.LimitRate)
-	if new > t.LimitSize {
-		atomic.StoreInt64(&t.tokens, t.LimitSize)
+	t.refill()
+	return t.Snippet
+}
+
+// Reservation 令牌预约，延迟 Delay 后方可执行
+type Reservation struct {
+	limiter   *TokenBucketLimiter
+	tokens    int64
+	ok        bool
+	timeToAct time.Time
+	//1-已取消
+	canceled int32
+}
+
+// OK 是否预约成功，n 超过 LimitSize 时永远无法满足
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay 距可执行的等待时间
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return 0
+	}
+	return max(r.timeToAct.Sub(clockOr(r.limiter.clock).Now()), 0)
+}
+
+// Cancel 放弃执行，尚未到执行时间时归还令牌，重复调用无效
+func (r *Reservation) Cancel() {
+	if !r.ok || r.tokens == 0 || !atomic.CompareAndSwapInt32(&r.canceled, 0, 1) {
+		return
 	}
-	if new < t.LimitRate {
-		atomic.StoreInt64(&t.tokens, t.LimitRate)
+	if !clockOr(r.limiter.clock).Now().Before(r.timeToAct) {
+		return
+	}
+	//补充可能已偿还部分欠额，归还后不超过上限
+	t := r.limiter
+	for {
+		cur := atomic.LoadInt64(&t.tokens)
+		refund := min(r.tokens, t.LimitSize-cur)
+		if refund <= 0 || atomic.CompareAndSwapInt64(&t.tokens, cur, cur+refund) {
+			return
+		}
+	}
+}
+
+// Reserve 预约n个令牌，立即扣减（可欠额），返回需等待的时间
+// 等待时间按令牌缺口及每 Snippet 补充 LimitRate 个估算
+func (t *TokenBucketLimiter) Reserve(n int64) *Reservation {
+	r := &Reservation{limiter: t, ok: true, timeToAct: clockOr(t.clock).Now()}
+	if atomic.LoadInt32(&t.stopFlag) == 1 {
+		return r
+	}
+	if n > t.LimitSize || t.LimitRate <= 0 {
+		r.ok = false
+		return r
+	}
+	if t.lazy {
+		t.advance()
+	}
+	r.tokens = n
+	new := atomic.AddInt64(&t.tokens, -n)
+	switch {
+	case new >= 0:
+	case t.lazy:
+		//惰性模式按比例连续补充
+		snippet := int64(t.Snippet)
+		r.timeToAct = r.timeToAct.Add(time.Duration((-new*snippet + t.LimitRate - 1) / t.LimitRate))
+	default:
+		batches := (-new + t.LimitRate - 1) / t.LimitRate
+		r.timeToAct = r.timeToAct.Add(time.Duration(batches) * t.Snippet)
+	}
+	return r
+}
+
+// Wait 申请n个令牌，不足时阻塞等待，ctx 结束或截止时间不够等待时返回错误
+func (t *TokenBucketLimiter) Wait(ctx context.Context, n int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r := t.Reserve(n)
+	if !r.OK() {
+		return errors.New("rate limit exceeds limit size")
+	}
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+	//截止时间为系统时间，与注入的时钟比较时长
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		r.Cancel()
+		return errors.New("rate limit would exceed context deadline")
+	}
+	timer := clockOr(t.clock).NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
 	}
-	return t.Snippet
 }
 
 // Close 关闭。
@@ -89,6 +306,171 @@ func (t *TokenBucketLimiter) Close() {
 	atomic.StoreInt32(&t.stopFlag, 1)
 }
 
+// Allow 申请1个令牌
+func (t *TokenBucketLimiter) Allow() bool {
+	return t.Take(1) == nil
+}
+
+// SlidingWindowLimiter 滑动窗口计数限流，任意 Window 长度的时间内最多通过 Limit 个
+// 以上一个固定窗口的计数按重叠比例加权估算，内存固定，精度高于固定窗口
+type SlidingWindowLimiter struct {
+	//窗口内最大通过数
+	Limit int64
+	//窗口长度
+	Window time.Duration
+	mutex  sync.Mutex
+	//当前固定窗口的起点，单调时钟纳秒数
+	start      int64
+	prev, curr int64
+}
+
+// NewSlidingWindowLimiter 新建，window 须大于0
+func NewSlidingWindowLimiter(limit int64, window time.Duration) *SlidingWindowLimiter {
+	if window <= 0 {
+		panic("SlidingWindowLimiter: window 须大于0")
+	}
+	return &SlidingWindowLimiter{
+		Limit:  limit,
+		Window: window,
+		start:  monotonicNow(),
+	}
+}
+
+// advance 滑动到now所在的固定窗口，返回now在窗口内的偏移，需持有锁
+func (s *SlidingWindowLimiter) advance(now int64) int64 {
+	window := int64(s.Window)
+	switch n := (now - s.start) / window; {
+	case n == 1:
+		s.prev, s.curr = s.curr, 0
+		s.start += window
+	case n > 1:
+		s.prev, s.curr = 0, 0
+		s.start += n * window
+	}
+	return now - s.start
+}
+
+// take 申请n个，失败时返回建议的等待时间
+func (s *SlidingWindowLimiter) take(n int64) (bool, time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	elapsed := s.advance(monotonicNow())
+	window := int64(s.Window)
+	//以浮点计算权重，计数与纳秒相乘会溢出
+	remain := float64(window-elapsed) / float64(window)
+	estimate := int64(float64(s.prev)*remain) + s.curr
+	if estimate+n <= s.Limit {
+		s.curr += n
+		return true, 0
+	}
+	if free := s.Limit - s.curr - n; free >= 0 && s.prev > 0 {
+		//上一窗口的权重随时间下降，求其降到 free 以下的时刻
+		wait := float64(window-elapsed) - float64(free)/float64(s.prev)*float64(window)
+		return false, time.Duration(max(wait, 1))
+	}
+	return false, time.Duration(window - elapsed)
+}
+
+// Allow 申请1个
+func (s *SlidingWindowLimiter) Allow() bool {
+	ok, _ := s.take(1)
+	return ok
+}
+
+// Take 申请n个，超出限额时立即返回错误
+func (s *SlidingWindowLimiter) Take(n int64) error {
+	if ok, _ := s.take(n); !ok {
+		return errors.New("rate limit")
+	}
+	return nil
+}
+
+// Wait 申请n个，超出限额时等待
+func (s *SlidingWindowLimiter) Wait(ctx context.Context, n int64) error {
+	if n > s.Limit {
+		return errors.New("rate limit exceeds limit")
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ok, wait := s.take(n)
+		if ok {
+			return nil
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// LeakyBucketLimiter 漏桶限流，请求按固定间隔均匀通过，Slack 允许空闲后积累少量突发
+type LeakyBucketLimiter struct {
+	//相邻请求的间隔
+	interval int64
+	//允许积累的突发请求数
+	slack int64
+	//最后一个已安排请求的结束时刻，单调时钟纳秒数
+	last int64
+}
+
+// NewLeakyBucketLimiter 每 per 时间通过 rate 个请求，slack 为允许的突发数
+func NewLeakyBucketLimiter(rate int64, per time.Duration, slack int64) *LeakyBucketLimiter {
+	return &LeakyBucketLimiter{
+		interval: max(int64(per)/max(rate, 1), 1),
+		slack:    max(slack, 0),
+		last:     math.MinInt64 / 2,
+	}
+}
+
+// reserve 预约n个请求的时段，返回第n个请求需等待的时间；等待时间超过limit时不预约
+func (l *LeakyBucketLimiter) reserve(n int64, limit time.Duration) (time.Duration, bool) {
+	for {
+		now := monotonicNow()
+		last := atomic.LoadInt64(&l.last)
+		//空闲时最多积累 slack 个请求的额度
+		base := max(last, now-l.slack*l.interval)
+		//n个请求依次间隔 interval，以最后一个为准
+		wait := time.Duration(base + (n-1)*l.interval - now)
+		if wait > limit {
+			return wait, false
+		}
+		if atomic.CompareAndSwapInt64(&l.last, last, base+n*l.interval) {
+			return max(wait, 0), true
+		}
+	}
+}
+
+// Allow 申请1个
+func (l *LeakyBucketLimiter) Allow() bool {
+	_, ok := l.reserve(1, 0)
+	return ok
+}
+
+// Take 申请n个，需要等待时立即返回错误，n 超过 slack+1 时总是失败
+func (l *LeakyBucketLimiter) Take(n int64) error {
+	if _, ok := l.reserve(n, 0); !ok {
+		return errors.New("rate limit")
+	}
+	return nil
+}
+
+// Wait 申请n个，等待到预约的时刻，ctx 截止时间不够等待时不预约并返回错误
+func (l *LeakyBucketLimiter) Wait(ctx context.Context, n int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	limit := time.Duration(math.MaxInt64)
+	if deadline, ok := ctx.Deadline(); ok {
+		limit = time.Until(deadline)
+	}
+	wait, ok := l.reserve(n, limit)
+	if !ok {
+		return errors.New("rate limit would exceed context deadline")
+	}
+	return sleepContext(ctx, wait)
+}
+
 // https://golang.org/x/time/rate
 // https://studygolang.com/articles/27454#reply0
 // https://zhuanlan.zhihu.com/p/89820414
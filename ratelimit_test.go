@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -74,3 +78,331 @@ func TestTake(t *testing.T) {
 8 0s 2 rate limit
 9 0s 1
 */
+
+func TestReserve(t *testing.T) {
+	limiter := NewTokenBucketLimiter(2, 4, 10*time.Millisecond)
+	if r := limiter.Reserve(4); !r.OK() || r.Delay() != 0 {
+		t.Fatal(r.Delay())
+	}
+	r := limiter.Reserve(3)
+	if !r.OK() || r.Delay() <= 10*time.Millisecond || r.Delay() > 20*time.Millisecond {
+		t.Fatal(r.Delay())
+	}
+	r.Cancel()
+	r.Cancel()
+	if atomic.LoadInt64(&limiter.tokens) != 0 {
+		t.Fatal(limiter.tokens)
+	}
+	if r := limiter.Reserve(5); r.OK() {
+		t.Fatal("expected not ok")
+	}
+	// 欠额须由补充逐批偿还
+	limiter.Reserve(3)
+	limiter.Task()
+	if atomic.LoadInt64(&limiter.tokens) != -1 {
+		t.Fatal(limiter.tokens)
+	}
+	// 补充已偿还欠额后取消，不超过上限
+	limiter = NewTokenBucketLimiter(10, 10, time.Hour)
+	limiter.Take(10)
+	r = limiter.Reserve(5)
+	limiter.Task()
+	limiter.Task()
+	r.Cancel()
+	if atomic.LoadInt64(&limiter.tokens) != 10 {
+		t.Fatal(limiter.tokens)
+	}
+	limiter.Take(10)
+	r = limiter.Reserve(5)
+	limiter.Task()
+	r.Cancel()
+	if atomic.LoadInt64(&limiter.tokens) != 10 {
+		t.Fatal(limiter.tokens)
+	}
+}
+
+func TestLimiterWait(t *testing.T) {
+	limiter := NewTokenBucketLimiter(10, 10, 10*time.Millisecond)
+	defer limiter.Close()
+	go limiter.Run()
+	ctx := context.Background()
+	if err := limiter.Wait(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	prev := time.Now()
+	if err := limiter.Wait(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(prev) < 5*time.Millisecond {
+		t.Fatal(time.Since(prev))
+	}
+	if err := limiter.Wait(ctx, 11); err == nil {
+		t.Fatal("expected error")
+	}
+	short, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(short, 10); err == nil {
+		t.Fatal("expected deadline error")
+	}
+	canceled, cancel2 := context.WithCancel(ctx)
+	cancel2()
+	if err := limiter.Wait(canceled, 1); !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+}
+
+func TestLazyTokenBucketLimiter(t *testing.T) {
+	//每毫秒1个令牌
+	limiter := NewLazyTokenBucketLimiter(10, 10, 10*time.Millisecond)
+	if err := limiter.Take(10); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Take(2); err == nil {
+		t.Fatal("expected rate limit")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := limiter.Take(4); err != nil {
+		t.Fatal(err, limiter.tokens)
+	}
+	if limiter.Task() != 0 {
+		t.Fatal("lazy limiter should not be scheduled")
+	}
+	time.Sleep(50 * time.Millisecond)
+	limiter.advance()
+	if atomic.LoadInt64(&limiter.tokens) != 10 {
+		t.Fatal(limiter.tokens)
+	}
+	r := limiter.Reserve(15)
+	if r.OK() {
+		t.Fatal("expected not ok")
+	}
+	limiter.Take(7)
+	r = limiter.Reserve(6)
+	if d := r.Delay(); d < 2*time.Millisecond || d > 3*time.Millisecond {
+		t.Fatal(d)
+	}
+}
+
+func TestLazyTokenBucketLimiterConcurrent(t *testing.T) {
+	limiter := NewLazyTokenBucketLimiter(1, 10, time.Millisecond)
+	start := time.Now()
+	var count int64
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Since(start) < 50*time.Millisecond {
+				if limiter.Take(1) == nil {
+					atomic.AddInt64(&count, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	ms := int64(time.Since(start) / time.Millisecond)
+	if count < 10 || count > 10+ms+1 {
+		t.Fatal(count, ms)
+	}
+}
+
+func BenchmarkLazyTake(b *testing.B) {
+	limiter := NewLazyTokenBucketLimiter(1000, 16*1024, 10*time.Millisecond)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			limiter.Take(1)
+		}
+	})
+}
+
+func TestSlidingWindowLimiter(t *testing.T) {
+	s := NewSlidingWindowLimiter(10, 50*time.Millisecond)
+	for i := range 10 {
+		if !s.Allow() {
+			t.Fatal(i)
+		}
+	}
+	if s.Allow() || s.Take(1) == nil {
+		t.Fatal("expected rate limit")
+	}
+	prev := time.Now()
+	if err := s.Wait(context.Background(), 5); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(prev) < 10*time.Millisecond {
+		t.Fatal(time.Since(prev))
+	}
+	if err := s.Wait(context.Background(), 11); err == nil {
+		t.Fatal("expected error")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := s.Wait(ctx, 10); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	NewSlidingWindowLimiter(10, 0)
+}
+
+func TestSlidingWindowLimiterRate(t *testing.T) {
+	s := NewSlidingWindowLimiter(20, 20*time.Millisecond)
+	start := time.Now()
+	var count int64
+	for time.Since(start) < 100*time.Millisecond {
+		if s.Allow() {
+			count++
+		}
+	}
+	//约每毫秒1个
+	if count < 80 || count > 140 {
+		t.Fatal(count)
+	}
+}
+
+func TestSlidingWindowLimiterLarge(t *testing.T) {
+	s := NewSlidingWindowLimiter(1_000_000, 24*time.Hour)
+	if err := s.Take(1_000_000); err != nil {
+		t.Fatal(err)
+	}
+	//前一天用满，进入新一天1小时
+	s.start -= int64(25 * time.Hour)
+	var count int64
+	for s.Allow() {
+		count++
+	}
+	//约 1000000/24
+	if count < 41_600 || count > 41_700 {
+		t.Fatal(count)
+	}
+}
+
+func TestLeakyBucketLimiter(t *testing.T) {
+	//每毫秒1个，允许突发2个
+	l := NewLeakyBucketLimiter(1, time.Millisecond, 2)
+	if !l.Allow() || !l.Allow() {
+		t.Fatal("slack")
+	}
+	//突发额度已用完
+	if l.Take(5) == nil {
+		t.Fatal("expected rate limit")
+	}
+	if err := NewLeakyBucketLimiter(1, time.Millisecond, 2).Take(3); err != nil {
+		t.Fatal(err)
+	}
+	if NewLeakyBucketLimiter(1, time.Second, 0).Take(1000) == nil {
+		t.Fatal("expected rate limit")
+	}
+	l = NewLeakyBucketLimiter(1, 2*time.Millisecond, 0)
+	ctx := context.Background()
+	prev := time.Now()
+	for range 10 {
+		if err := l.Wait(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(prev); elapsed < 17*time.Millisecond {
+		t.Fatal(elapsed)
+	}
+	prev = time.Now()
+	if err := l.Wait(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(prev); elapsed < 17*time.Millisecond {
+		t.Fatal(elapsed)
+	}
+	//间隔远大于截止时间
+	l = NewLeakyBucketLimiter(1, time.Second, 0)
+	if !l.Allow() {
+		t.Fatal("first request")
+	}
+	short, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if err := l.Wait(short, 1); err == nil {
+		t.Fatal("expected deadline error")
+	}
+}
+
+func BenchmarkLimiters(b *testing.B) {
+	limiters := map[string]Limiter{
+		"TokenBucket":   NewLazyTokenBucketLimiter(1000, 1000, time.Millisecond),
+		"SlidingWindow": NewSlidingWindowLimiter(1000, time.Millisecond),
+		"LeakyBucket":   NewLeakyBucketLimiter(1000, time.Millisecond, 100),
+	}
+	for name, l := range limiters {
+		b.Run(name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					l.Allow()
+				}
+			})
+		})
+	}
+}
+
+func TestLazyTokenBucketLimiterDebt(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	limiter := NewLazyTokenBucketLimiter(10, 10, 10*time.Millisecond).SetClock(clock)
+	limiter.Take(10)
+	limiter.Reserve(5)
+	//空闲足够久后补满，欠额不再扣减
+	clock.Advance(time.Hour)
+	if err := limiter.Take(10); err != nil {
+		t.Fatal(err, limiter.tokens)
+	}
+}
+
+func TestTokenBucketLimiterFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	limiter := NewLazyTokenBucketLimiter(10, 10, 10*time.Millisecond).SetClock(clock)
+	if err := limiter.Take(10); err != nil {
+		t.Fatal(err)
+	}
+	if limiter.Allow() {
+		t.Fatal("expected rate limit")
+	}
+	clock.Advance(5 * time.Millisecond)
+	if err := limiter.Take(5); err != nil {
+		t.Fatal(err)
+	}
+	r := limiter.Reserve(3)
+	if d := r.Delay(); d != 3*time.Millisecond {
+		t.Fatal(d)
+	}
+	done := make(chan error)
+	go func() {
+		done <- limiter.Wait(context.Background(), 2)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatal("expected wait", err)
+	default:
+	}
+	clock.Advance(5 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	//时钟与系统时间无关，按时长判断截止时间
+	clock = NewFakeClock(time.Now().Add(24 * time.Hour))
+	limiter = NewLazyTokenBucketLimiter(10, 10, 10*time.Millisecond).SetClock(clock)
+	limiter.Take(10)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go func() {
+		done <- limiter.Wait(ctx, 1)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	clock.Advance(time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	short, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(short, 5); err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+}
@@ -1,6 +1,10 @@
 package utils
 
 import (
+	"math/bits"
+	"math/rand/v2"
+	"runtime"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -16,12 +20,34 @@ type RollingWindow struct {
 	//2^3=8,2^10=1024 例：1024*1024*8=8,388,608 约8ms  10+10+3=23
 	bucketleghthPow, ringPow int
 	mask                     int64
-	array                    []int64
-	round                    []int64
+	buckets                  []atomic.Pointer[rollingBucket]
+	//分片数减一，分片数为不小于 GOMAXPROCS 的2的幂
+	stripeMask uint32
+	//时钟，nil 为系统时钟
+	clock Clock
+}
+
+// rollingBucket 单个窗口，轮次变更时以CAS整体替换，无需加锁
+// 计数分散到多个分片，减少同一窗口上的竞争
+type rollingBucket struct {
+	round   int64
+	stripes []rollingStripe
+}
+
+// rollingStripe 独占缓存行的计数分片
+type rollingStripe struct {
+	value int64
 	//Padding
 	_ [7]int64
-	//0 表示未锁定，非1表示锁定
-	spinLock int64
+}
+
+// sum 各分片之和
+func (b *rollingBucket) sum() int64 {
+	var sum int64
+	for i := range b.stripes {
+		sum += atomic.LoadInt64(&b.stripes[i].value)
+	}
+	return sum
 }
 
 // NewRollingWindow
@@ -33,69 +59,139 @@ func NewRollingWindow(totalPow, interval, bucketleghthPow int) *RollingWindow {
 		ringPow:         bucketleghthPow + totalPow,
 		mask:            1<<(bucketleghthPow+totalPow) - 1,
 	}
-	r.array = make([]int64, r.bucketsCount)
-	r.round = make([]int64, r.bucketsCount)
+	r.buckets = make([]atomic.Pointer[rollingBucket], r.bucketsCount)
+	//Go 无法取得当前CPU，以每P独立的随机数选择分片近似
+	r.stripeMask = 1<<bits.Len(uint(runtime.GOMAXPROCS(0)-1)) - 1
 	return r
 }
 
-// Add
+// rollingWindowPows 按时长换算 NewRollingWindow 的参数
+// 单个窗口长度取不超过 window/buckets 的2的幂，窗口数量相应增加，统计时长误差不超过一个窗口
+func rollingWindowPows(window time.Duration, buckets int) (totalPow, interval, bucketleghthPow int) {
+	if window <= 0 || buckets < 1 {
+		panic("RollingWindow: window 与 buckets 须大于0")
+	}
+	bucketleghthPow = bits.Len64(uint64(max(window/time.Duration(buckets), 1))) - 1
+	interval = int((int64(window) + 1<<bucketleghthPow - 1) >> bucketleghthPow)
+	//统计时不含当前及上一个窗口
+	totalPow = bits.Len(uint(interval + 1))
+	return
+}
+
+// NewRollingWindowDuration 按统计时长与窗口数量新建，如 NewRollingWindowDuration(time.Second, 10)
+func NewRollingWindowDuration(window time.Duration, buckets int) *RollingWindow {
+	return NewRollingWindow(rollingWindowPows(window, buckets))
+}
+
+// SetClock 设置时钟，须在使用前设置
+func (r *RollingWindow) SetClock(c Clock) *RollingWindow {
+	r.clock = c
+	return r
+}
+
+// now 当前纳秒时间
+func (r *RollingWindow) now() int64 {
+	return clockOr(r.clock).Now().UnixNano()
+}
+
+// BucketDuration 单个窗口长度
+func (r *RollingWindow) BucketDuration() time.Duration {
+	return 1 << r.bucketleghthPow
+}
+
+// newBucket 轮次round的新窗口，初始值n
+func (r *RollingWindow) newBucket(round, n int64) *rollingBucket {
+	b := &rollingBucket{round: round, stripes: make([]rollingStripe, r.stripeMask+1)}
+	b.stripes[0].value = n
+	return b
+}
+
+// value 窗口i的值
+func (r *RollingWindow) value(i int) int64 {
+	if b := r.buckets[i].Load(); b != nil {
+		return b.sum()
+	}
+	return 0
+}
+
+// roundOf 窗口i的轮次，未写入时为-1
+func (r *RollingWindow) roundOf(i int) int64 {
+	if b := r.buckets[i].Load(); b != nil {
+		return b.round
+	}
+	return -1
+}
+
+// Add 累加到当前窗口，轮次变更时CAS替换窗口，不会阻塞
 func (r *RollingWindow) Add(n int64) {
-	now := time.Now().UnixNano()
-	NewRound := now >> r.ringPow
-	pos := (int)(now&r.mask) >> r.bucketleghthPow
-	if atomic.LoadInt64(&r.round[pos]) == NewRound {
-		atomic.AddInt64(&r.array[pos], n)
-		return
-	}
-	var count int
+	round, pos := r.locate(r.now())
 	for {
-		if atomic.CompareAndSwapInt64(&r.spinLock, 0, 1) {
-			if atomic.LoadInt64(&r.round[pos]) == NewRound {
-				atomic.AddInt64(&r.array[pos], n)
-			} else {
-				atomic.StoreInt64(&r.array[pos], n)
-				atomic.StoreInt64(&r.round[pos], NewRound)
-			}
-			atomic.StoreInt64(&r.spinLock, 0)
+		b := r.buckets[pos].Load()
+		if b != nil && b.round == round {
+			atomic.AddInt64(&b.stripes[rand.Uint32()&r.stripeMask].value, n)
+			return
+		}
+		if b != nil && b.round > round {
+			//迟到的写入，窗口已进入新的轮次，丢弃
 			return
 		}
-		count++
-		if count > 10000 {
-			panic("RollingWindow.Add 自旋锁死锁")
+		if r.buckets[pos].CompareAndSwap(b, r.newBucket(round, n)) {
+			return
 		}
 	}
-
 }
 
-// Store
+// Store 以n覆盖当前窗口的值，同一轮次内复用窗口，不分配内存
 func (r *RollingWindow) Store(n int64) {
-	now := time.Now().UnixNano()
-	NewRound := now >> r.ringPow
-	pos := (int)(now&r.mask) >> r.bucketleghthPow
-	atomic.StoreInt64(&r.array[pos], n)
-	atomic.StoreInt64(&r.round[pos], NewRound)
+	round, pos := r.locate(r.now())
+	for {
+		b := r.buckets[pos].Load()
+		if b != nil && b.round == round {
+			atomic.StoreInt64(&b.stripes[0].value, n)
+			for i := range b.stripes[1:] {
+				atomic.StoreInt64(&b.stripes[i+1].value, 0)
+			}
+			return
+		}
+		if b != nil && b.round > round {
+			return
+		}
+		if r.buckets[pos].CompareAndSwap(b, r.newBucket(round, n)) {
+			return
+		}
+	}
+}
+
+// locate 时间now对应的轮次与窗口位置
+func (r *RollingWindow) locate(now int64) (int64, int) {
+	return now >> r.ringPow, (int)(now&r.mask) >> r.bucketleghthPow
 }
 
+// Sampling 最近interval个窗口中属于当前轮次的窗口序号
 func (r *RollingWindow) Sampling() []int {
-	now := time.Now().UnixNano()
-	offset := now >> r.ringPow
-	pre := (int)(now&r.mask)>>r.bucketleghthPow - 1
+	return r.sampling(r.roundOf, r.now())
+}
+
+// sampling 按round返回的轮次筛选最近interval个窗口
+func (r *RollingWindow) sampling(round func(int) int64, now int64) []int {
+	offset, pos := r.locate(now)
+	pre := pos - 1
 	var l []int
 	if pre >= r.interval {
 		for i := pre - r.interval; i < pre; i++ {
-			if r.round[i] == offset {
+			if round(i) == offset {
 				l = append(l, i)
 			}
 		}
 	} else {
 		for i := r.bucketsCount + pre - r.interval; i < r.bucketsCount; i++ {
-			if r.round[i] == offset-1 {
+			if round(i) == offset-1 {
 				l = append(l, i)
 			}
 		}
 		if pre > 0 {
-			for i := range r.round[:pre] {
-				if r.round[i] == offset {
+			for i := range pre {
+				if round(i) == offset {
 					l = append(l, i)
 				}
 			}
@@ -104,6 +200,199 @@ func (r *RollingWindow) Sampling() []int {
 	return l
 }
 
+// Sum 最近interval个窗口的总和
+func (r *RollingWindow) Sum() int64 {
+	var sum int64
+	for _, i := range r.Sampling() {
+		sum += r.value(i)
+	}
+	return sum
+}
+
+// sumLive 含当前窗口在内最近interval个窗口的总和，无统计延迟，但当前窗口尚未写完
+func (r *RollingWindow) sumLive() int64 {
+	offset, pos := r.locate(r.now())
+	var sum int64
+	for k := range r.interval {
+		i, round := pos-k, offset
+		if i < 0 {
+			i, round = i+r.bucketsCount, offset-1
+		}
+		if r.roundOf(i) == round {
+			sum += r.value(i)
+		}
+	}
+	return sum
+}
+
+// Count 最近interval个窗口中有数据的窗口数
+func (r *RollingWindow) Count() int {
+	return len(r.Sampling())
+}
+
+// Avg 最近interval个窗口的平均值，无数据时为0
+func (r *RollingWindow) Avg() float64 {
+	l := r.Sampling()
+	if len(l) == 0 {
+		return 0
+	}
+	var sum int64
+	for _, i := range l {
+		sum += r.value(i)
+	}
+	return float64(sum) / float64(len(l))
+}
+
+// Max 最近interval个窗口的最大值，无数据时为0
+func (r *RollingWindow) Max() int64 {
+	l := r.Sampling()
+	if len(l) == 0 {
+		return 0
+	}
+	result := r.value(l[0])
+	for _, i := range l[1:] {
+		result = max(result, r.value(i))
+	}
+	return result
+}
+
+// Min 最近interval个窗口的最小值，无数据时为0
+func (r *RollingWindow) Min() int64 {
+	l := r.Sampling()
+	if len(l) == 0 {
+		return 0
+	}
+	result := r.value(l[0])
+	for _, i := range l[1:] {
+		result = min(result, r.value(i))
+	}
+	return result
+}
+
+// 直方图每个2的幂区间再等分的份数，相对误差约 1/histogramSubBins
+const (
+	histogramSubBits = 3
+	histogramSubBins = 1 << histogramSubBits
+	histogramBins    = histogramSubBins + (63-histogramSubBits)*histogramSubBins
+)
+
+// histogramIndex 值v所在的区间，小于histogramSubBins时精确，之后按对数分段线性细分
+func histogramIndex(v int64) int {
+	if v < histogramSubBins {
+		return int(max(v, 0))
+	}
+	e := bits.Len64(uint64(v)) - 1
+	sub := int(v>>(e-histogramSubBits)) & (histogramSubBins - 1)
+	return histogramSubBins + (e-histogramSubBits)*histogramSubBins + sub
+}
+
+// histogramValue 区间的代表值（中点）
+func histogramValue(idx int) int64 {
+	if idx < histogramSubBins {
+		return int64(idx)
+	}
+	e := (idx-histogramSubBins)/histogramSubBins + histogramSubBits
+	sub := int64((idx - histogramSubBins) % histogramSubBins)
+	width := int64(1) << (e - histogramSubBits)
+	return (histogramSubBins+sub)*width + width/2
+}
+
+// RollingHistogram 环形滑动窗口直方图，统计最近interval个窗口内的分位数，如延迟的p50/p90/p99
+type RollingHistogram struct {
+	//窗口划分与 RollingWindow 相同
+	window *RollingWindow
+	bins   [][histogramBins]int64
+	round  []int64
+	mutex  sync.Mutex
+}
+
+// NewRollingHistogram 参数同 NewRollingWindow
+func NewRollingHistogram(totalPow, interval, bucketleghthPow int) *RollingHistogram {
+	w := NewRollingWindow(totalPow, interval, bucketleghthPow)
+	return &RollingHistogram{
+		window: w,
+		bins:   make([][histogramBins]int64, w.bucketsCount),
+		round:  make([]int64, w.bucketsCount),
+	}
+}
+
+// NewRollingHistogramDuration 参数同 NewRollingWindowDuration
+func NewRollingHistogramDuration(window time.Duration, buckets int) *RollingHistogram {
+	return NewRollingHistogram(rollingWindowPows(window, buckets))
+}
+
+// SetClock 设置时钟，须在使用前设置
+func (h *RollingHistogram) SetClock(c Clock) *RollingHistogram {
+	h.window.SetClock(c)
+	return h
+}
+
+// Observe 记录一个样本，负数按0计
+func (h *RollingHistogram) Observe(v int64) {
+	round, pos := h.window.locate(h.window.now())
+	if atomic.LoadInt64(&h.round[pos]) != round {
+		h.mutex.Lock()
+		if atomic.LoadInt64(&h.round[pos]) != round {
+			for i := range h.bins[pos] {
+				atomic.StoreInt64(&h.bins[pos][i], 0)
+			}
+			atomic.StoreInt64(&h.round[pos], round)
+		}
+		h.mutex.Unlock()
+	}
+	atomic.AddInt64(&h.bins[pos][histogramIndex(v)], 1)
+}
+
+// merge 合并最近interval个窗口的直方图
+func (h *RollingHistogram) merge() (merged [histogramBins]int64, total int64) {
+	for _, p := range h.window.sampling(h.roundOf, h.window.now()) {
+		for i := range merged {
+			n := atomic.LoadInt64(&h.bins[p][i])
+			merged[i] += n
+			total += n
+		}
+	}
+	return
+}
+
+// roundOf 窗口i的轮次
+func (h *RollingHistogram) roundOf(i int) int64 {
+	return atomic.LoadInt64(&h.round[i])
+}
+
+// Count 最近interval个窗口的样本数
+func (h *RollingHistogram) Count() int64 {
+	_, total := h.merge()
+	return total
+}
+
+// Quantile 分位数，q取值0-1，如0.99；无样本时为0
+func (h *RollingHistogram) Quantile(q float64) int64 {
+	return h.Quantiles(q)[0]
+}
+
+// Quantiles 一次计算多个分位数，qs 需升序
+func (h *RollingHistogram) Quantiles(qs ...float64) []int64 {
+	result := make([]int64, len(qs))
+	merged, total := h.merge()
+	if total == 0 {
+		return result
+	}
+	var sum int64
+	j := 0
+	for i := range merged {
+		sum += merged[i]
+		for j < len(qs) && float64(sum) >= qs[j]*float64(total) && sum > 0 {
+			result[j] = histogramValue(i)
+			j++
+		}
+		if j == len(qs) {
+			break
+		}
+	}
+	return result
+}
+
 // https://zhuanlan.zhihu.com/p/693443092
 // https://www.cnblogs.com/luoxn28/p/11109144.html
 // https://www.jianshu.com/p/9cb6aa788520
@@ -2,16 +2,26 @@ package utils
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 )
 
+// snapshot 各窗口的值与轮次
+func (r *RollingWindow) snapshot() (values, rounds []int64) {
+	for i := range r.bucketsCount {
+		values = append(values, r.value(i))
+		rounds = append(rounds, r.roundOf(i))
+	}
+	return
+}
+
 func testMetric( r *RollingWindow, t time.Duration) func() time.Duration {
 	return func() time.Duration {
 		var count int64
 		l := r.Sampling()
 		for _, v := range l {
-			count = count + r.array[v]
+			count = count + r.value(v)
 		}
 		fmt.Println(count, l)
 		return t
@@ -29,8 +39,7 @@ func TestRollingWindowStore(t *testing.T) {
 		time.Sleep(134 * time.Millisecond)
 		r.Store(int64(i + 100))
 	}
-	fmt.Println(r.array)
-	fmt.Println(r.round)
+	fmt.Println(r.snapshot())
 }
 
 /*
@@ -45,15 +54,13 @@ func TestRollingWindowAdd(t *testing.T) {
 		time.Sleep(134 * time.Millisecond)
 		r.Add(1)
 	}
-	fmt.Println(r.array)
-	fmt.Println(r.round)
+	fmt.Println(r.snapshot())
 	time.Sleep(500 * time.Millisecond)
 	for range 80 {
 		time.Sleep(13 * time.Millisecond)
 		r.Add(1)
 	}
-	fmt.Println(r.array)
-	fmt.Println(r.round)
+	fmt.Println(r.snapshot())
 }
 
 /*
@@ -70,8 +77,7 @@ func TestRollingWindowSampling(t *testing.T) {
 	}
 	time.Sleep(134 * time.Millisecond)
 	testMetric(r, time.Millisecond)
-	fmt.Println(r.array)
-	fmt.Println(r.round)
+	fmt.Println(r.snapshot())
 	time.Sleep(500 * time.Millisecond)
 	for range 80 {
 		time.Sleep(13 * time.Millisecond)
@@ -79,15 +85,15 @@ func TestRollingWindowSampling(t *testing.T) {
 	}
 	pre := (int)(time.Now().UnixNano()&r.mask)>>r.bucketleghthPow - 2
 	if pre > -1 {
-		r.round[pre] = 0
-		r.round[pre+1] = 0
+		r.buckets[pre].Store(nil)
+		r.buckets[pre+1].Store(nil)
 	} else {
-		r.round[r.bucketsCount-1] = 0
+		r.buckets[r.bucketsCount-1].Store(nil)
 	}
 	f := testMetric(r, time.Millisecond)
 	f()
-	fmt.Println(pre, r.array)
-	fmt.Println(r.round)
+	fmt.Println(pre)
+	fmt.Println(r.snapshot())
 }
 
 /*
@@ -111,4 +117,153 @@ func BenchmarkRollingWindowAdd(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		r.Add(1)
 	}
-}
\ No newline at end of file
+}
+
+func BenchmarkRollingWindowAddParallel(b *testing.B) {
+	r := NewRollingWindow(4, 6, 27)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r.Add(1)
+		}
+	})
+}
+func TestRollingWindowAggregate(t *testing.T) {
+	//2^4=16 ,2^24=16,777,216 约16.7ms
+	r := NewRollingWindow(4, 6, 24)
+	if r.Sum() != 0 || r.Count() != 0 || r.Avg() != 0 || r.Max() != 0 || r.Min() != 0 {
+		t.Fatal("expected empty")
+	}
+	for range 8 {
+		r.Store(10)
+		time.Sleep(17 * time.Millisecond)
+	}
+	time.Sleep(17 * time.Millisecond)
+	n := r.Count()
+	if n < 3 || n > 6 || r.Sum() != int64(10*n) || r.Avg() != 10 || r.Max() != 10 || r.Min() != 10 {
+		t.Fatal(n, r.Sum(), r.Avg(), r.Max(), r.Min())
+	}
+}
+
+func TestHistogramIndex(t *testing.T) {
+	for _, v := range []int64{0, 1, 7, 8, 9, 15, 16, 100, 1000, 123456789, 1 << 62} {
+		idx := histogramIndex(v)
+		if idx < 0 || idx >= histogramBins {
+			t.Fatal(v, idx)
+		}
+		got := histogramValue(idx)
+		if diff := got - v; diff*histogramSubBins > v || -diff*histogramSubBins > v {
+			t.Fatal(v, idx, got)
+		}
+	}
+}
+
+func TestRollingHistogram(t *testing.T) {
+	h := NewRollingHistogram(4, 6, 24)
+	if h.Quantile(0.5) != 0 {
+		t.Fatal(h.Quantile(0.5))
+	}
+	for i := range 1000 {
+		h.Observe(int64(i + 1))
+	}
+	time.Sleep(60 * time.Millisecond)
+	if h.Count() != 1000 {
+		t.Fatal(h.Count())
+	}
+	q := h.Quantiles(0.5, 0.9, 0.99)
+	for i, want := range []int64{500, 900, 990} {
+		if diff := q[i] - want; diff*histogramSubBins > want || -diff*histogramSubBins > want {
+			t.Fatal(q)
+		}
+	}
+}
+
+func BenchmarkRollingHistogramObserve(b *testing.B) {
+	h := NewRollingHistogram(4, 6, 27)
+	for i := 0; i < b.N; i++ {
+		h.Observe(int64(i))
+	}
+}
+
+func TestRollingWindowConcurrent(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 1000<<31))
+	r := NewRollingWindowDuration(time.Second, 10).SetClock(clock)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10000 {
+				r.Add(1)
+			}
+		}()
+	}
+	//并发写入期间切换窗口
+	for range 10 {
+		clock.Advance(r.BucketDuration())
+	}
+	wg.Wait()
+	clock.Advance(2 * r.BucketDuration())
+	if r.Sum() != 80000 {
+		t.Fatal(r.Sum())
+	}
+}
+
+func TestRollingWindowStoreReuse(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 1000<<31))
+	r := NewRollingWindowDuration(time.Second, 10).SetClock(clock)
+	r.Add(5)
+	//同一窗口内覆盖不分配内存
+	if n := testing.AllocsPerRun(100, func() { r.Store(3) }); n != 0 {
+		t.Fatal(n)
+	}
+	clock.Advance(2 * r.BucketDuration())
+	if r.Sum() != 3 {
+		t.Fatal(r.Sum())
+	}
+}
+
+func TestRollingWindowDuration(t *testing.T) {
+	r := NewRollingWindowDuration(time.Second, 10)
+	//2^26 约67ms，15个窗口约1.007秒
+	if r.BucketDuration() != 1<<26 || r.interval != 15 || r.bucketsCount != 32 {
+		t.Fatal(r.BucketDuration(), r.interval, r.bucketsCount)
+	}
+	//从整轮开始，轮次非0以免与未写入的窗口混淆
+	clock := NewFakeClock(time.Unix(0, 1000<<31))
+	r.SetClock(clock)
+	for range 20 {
+		r.Add(1)
+		clock.Advance(r.BucketDuration())
+	}
+	//不含当前及上一个窗口
+	if r.Count() != 15 || r.Sum() != 15 {
+		t.Fatal(r.Count(), r.Sum())
+	}
+	clock.Advance(15 * r.BucketDuration())
+	if r.Count() != 1 {
+		t.Fatal(r.Count())
+	}
+	clock.Advance(time.Second)
+	if r.Count() != 0 {
+		t.Fatal(r.Count())
+	}
+}
+
+func TestRollingHistogramFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 1000<<31))
+	h := NewRollingHistogramDuration(100*time.Millisecond, 4).SetClock(clock)
+	for i := range 100 {
+		h.Observe(int64(i + 1))
+	}
+	if h.Count() != 0 {
+		t.Fatal(h.Count())
+	}
+	clock.Advance(2 * h.window.BucketDuration())
+	if h.Count() != 100 {
+		t.Fatal(h.Count())
+	}
+	clock.Advance(time.Second)
+	if h.Count() != 0 {
+		t.Fatal(h.Count())
+	}
+}
@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"cmp"
+	"iter"
+	"maps"
+	"slices"
+)
+
+// Set 基于map的无序集合，非线程安全
+type Set[T comparable] map[T]struct{}
+
+// NewSet 新建
+func NewSet[T comparable](items ...T) Set[T] {
+	s := make(Set[T], len(items))
+	s.Add(items...)
+	return s
+}
+
+// Add 增加
+func (s Set[T]) Add(items ...T) {
+	for _, v := range items {
+		s[v] = struct{}{}
+	}
+}
+
+// Remove 移除
+func (s Set[T]) Remove(items ...T) {
+	for _, v := range items {
+		delete(s, v)
+	}
+}
+
+// Contains 是否包含
+func (s Set[T]) Contains(v T) bool {
+	_, ok := s[v]
+	return ok
+}
+
+// Len 元素个数
+func (s Set[T]) Len() int {
+	return len(s)
+}
+
+// Clone 复制
+func (s Set[T]) Clone() Set[T] {
+	return maps.Clone(s)
+}
+
+// Union 并集，返回新集合
+func (s Set[T]) Union(other Set[T]) Set[T] {
+	result := make(Set[T], max(len(s), len(other)))
+	for v := range s {
+		result[v] = struct{}{}
+	}
+	for v := range other {
+		result[v] = struct{}{}
+	}
+	return result
+}
+
+// Intersect 交集，返回新集合
+func (s Set[T]) Intersect(other Set[T]) Set[T] {
+	small, large := s, other
+	if len(small) > len(large) {
+		small, large = large, small
+	}
+	result := make(Set[T])
+	for v := range small {
+		if _, ok := large[v]; ok {
+			result[v] = struct{}{}
+		}
+	}
+	return result
+}
+
+// Difference 差集，返回在s中但不在other中的元素组成的新集合
+func (s Set[T]) Difference(other Set[T]) Set[T] {
+	result := make(Set[T])
+	for v := range s {
+		if _, ok := other[v]; !ok {
+			result[v] = struct{}{}
+		}
+	}
+	return result
+}
+
+// IsSubset s是否为other的子集
+func (s Set[T]) IsSubset(other Set[T]) bool {
+	if len(s) > len(other) {
+		return false
+	}
+	for v := range s {
+		if _, ok := other[v]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSuperset s是否为other的超集
+func (s Set[T]) IsSuperset(other Set[T]) bool {
+	return other.IsSubset(s)
+}
+
+// All 迭代，顺序不定
+func (s Set[T]) All() iter.Seq[T] {
+	return maps.Keys(s)
+}
+
+// ToSlice 转为切片，顺序不定
+func (s Set[T]) ToSlice() []T {
+	return slices.Collect(maps.Keys(s))
+}
+
+// SortedSet 基于有序切片的集合，迭代按升序，适合元素少、遍历多的场景，非线程安全
+// 零值可直接使用
+type SortedSet[T cmp.Ordered] struct {
+	items []T
+}
+
+// NewSortedSet 新建
+func NewSortedSet[T cmp.Ordered](items ...T) SortedSet[T] {
+	return SortedSet[T]{items: RemoveDuplicatesClone(items)}
+}
+
+// Add 增加
+func (s *SortedSet[T]) Add(items ...T) {
+	for _, v := range items {
+		if i, ok := slices.BinarySearch(s.items, v); !ok {
+			s.items = slices.Insert(s.items, i, v)
+		}
+	}
+}
+
+// Remove 移除
+func (s *SortedSet[T]) Remove(items ...T) {
+	for _, v := range items {
+		if i, ok := slices.BinarySearch(s.items, v); ok {
+			s.items = slices.Delete(s.items, i, i+1)
+		}
+	}
+}
+
+// Contains 是否包含
+func (s SortedSet[T]) Contains(v T) bool {
+	_, ok := slices.BinarySearch(s.items, v)
+	return ok
+}
+
+// Len 元素个数
+func (s SortedSet[T]) Len() int {
+	return len(s.items)
+}
+
+// Clone 复制
+func (s SortedSet[T]) Clone() SortedSet[T] {
+	return SortedSet[T]{items: slices.Clone(s.items)}
+}
+
+// Union 并集，返回新集合
+func (s SortedSet[T]) Union(other SortedSet[T]) SortedSet[T] {
+	a, b := s.items, other.items
+	result := make([]T, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			result = append(result, a[i])
+			i++
+		case a[i] > b[j]:
+			result = append(result, b[j])
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	result = append(result, a[i:]...)
+	result = append(result, b[j:]...)
+	return SortedSet[T]{items: result}
+}
+
+// Intersect 交集，返回新集合
+func (s SortedSet[T]) Intersect(other SortedSet[T]) SortedSet[T] {
+	a, b := s.items, other.items
+	var result []T
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return SortedSet[T]{items: result}
+}
+
+// Difference 差集，返回在s中但不在other中的元素组成的新集合
+func (s SortedSet[T]) Difference(other SortedSet[T]) SortedSet[T] {
+	a, b := s.items, other.items
+	var result []T
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			result = append(result, a[i])
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	result = append(result, a[i:]...)
+	return SortedSet[T]{items: result}
+}
+
+// IsSubset s是否为other的子集
+func (s SortedSet[T]) IsSubset(other SortedSet[T]) bool {
+	if len(s.items) > len(other.items) {
+		return false
+	}
+	return s.Difference(other).Len() == 0
+}
+
+// IsSuperset s是否为other的超集
+func (s SortedSet[T]) IsSuperset(other SortedSet[T]) bool {
+	return other.IsSubset(s)
+}
+
+// All 按升序迭代
+func (s SortedSet[T]) All() iter.Seq[T] {
+	return slices.Values(s.items)
+}
+
+// ToSlice 升序切片，与集合共享底层数组，不要修改
+func (s SortedSet[T]) ToSlice() []T {
+	return s.items
+}
+
+// https://github.com/deckarep/golang-set
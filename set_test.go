@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	a := NewSet(1, 2, 3, 3)
+	b := NewSet(2, 3, 4)
+	if a.Len() != 3 || !a.Contains(1) || a.Contains(4) {
+		t.Fatal(a)
+	}
+	var tests = []struct {
+		result Set[int]
+		want   []int
+	}{
+		{a.Union(b), []int{1, 2, 3, 4}},
+		{a.Intersect(b), []int{2, 3}},
+		{a.Difference(b), []int{1}},
+		{b.Difference(a), []int{4}},
+	}
+	for i := range tests {
+		r := tests[i].result.ToSlice()
+		slices.Sort(r)
+		if !reflect.DeepEqual(r, tests[i].want) {
+			t.Fatal(i, r, tests[i].want)
+		}
+	}
+	c := NewSet(2, 3)
+	if !c.IsSubset(a) || !a.IsSuperset(c) || a.IsSubset(c) || b.IsSubset(a) {
+		t.Fatal(a, b, c)
+	}
+	c.Add(5)
+	c.Remove(2)
+	if r := slices.Sorted(c.All()); !reflect.DeepEqual(r, []int{3, 5}) {
+		t.Fatal(r)
+	}
+}
+
+func TestSortedSet(t *testing.T) {
+	a := NewSortedSet(3, 1, 2, 3)
+	var b SortedSet[int]
+	b.Add(4, 2, 3, 4)
+	if a.Len() != 3 || !a.Contains(1) || a.Contains(4) {
+		t.Fatal(a)
+	}
+	var tests = []struct {
+		result SortedSet[int]
+		want   []int
+	}{
+		{a.Union(b), []int{1, 2, 3, 4}},
+		{a.Intersect(b), []int{2, 3}},
+		{a.Difference(b), []int{1}},
+		{b.Difference(a), []int{4}},
+	}
+	for i := range tests {
+		if r := tests[i].result.ToSlice(); !reflect.DeepEqual(r, tests[i].want) {
+			t.Fatal(i, r, tests[i].want)
+		}
+	}
+	c := NewSortedSet(2, 3)
+	if !c.IsSubset(a) || !a.IsSuperset(c) || a.IsSubset(c) || b.IsSubset(a) {
+		t.Fatal(a, b, c)
+	}
+	c.Add(5)
+	c.Remove(2, 7)
+	if r := slices.Collect(c.All()); !reflect.DeepEqual(r, []int{3, 5}) {
+		t.Fatal(r)
+	}
+}
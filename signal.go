@@ -13,7 +13,7 @@ import (
 type signal struct {
 	value  any
 	effect func(any)
-	child  []int
+	child  SortedSet[int]
 }
 
 // Computer 衍生 - 衍生能缓存计算结果，避免重复的计算
@@ -21,7 +21,7 @@ type signal struct {
 
 type computer struct {
 	//所有的Signal父代
-	parentSignal []int
+	parentSignal SortedSet[int]
 	//求值链
 	evaluateChain []int
 	//求值函数
@@ -156,21 +156,17 @@ func (u *Universe) NewComputer(effect func(any), warp func(*Universe) (func() an
 		}
 		// 正负用于判断 signal 或 computer
 		if v < 0 {
-			ss := &u.signalSet[-v]
-			ss.child = append(ss.child, j)
-			c.parentSignal = append(c.parentSignal, v)
+			c.parentSignal.Add(v)
 		} else {
 			k := u.computerSet[v]
-			c.parentSignal = append(c.parentSignal, k.parentSignal...)
-			for _, i := range c.parentSignal {
-				ss := &u.signalSet[-i]
-				ss.child = append(ss.child, j)
-			}
+			c.parentSignal = c.parentSignal.Union(k.parentSignal)
 			c.evaluateChain = append(c.evaluateChain, k.evaluateChain...)
 			c.evaluateChain = append(c.evaluateChain, v)
 		}
 	}
-	c.parentSignal = RemoveDuplicates(c.parentSignal)
+	for i := range c.parentSignal.All() {
+		u.signalSet[-i].child.Add(j)
+	}
 	c.evaluateChain = UniqueWithoutSort(c.evaluateChain)
 	u.computerSet = append(u.computerSet, c)
 	return j
@@ -187,14 +183,8 @@ func (u *Universe) Operate(n int, do func(any)) {
 }
 
 func (u *Universe) Run() {
-	if len(u.signalSet) > 1 {
-		for i := range u.signalSet[1:] {
-			ss := &u.signalSet[i]
-			ss.child = UniqueWithoutSort(ss.child)
-		}
-	}
 	for i := range u.computerSet[1:] {
-		u.computerSet[i].parentSignal = nil
+		u.computerSet[i].parentSignal = SortedSet[int]{}
 	}
 	go func() {
 		for {
@@ -202,7 +192,7 @@ func (u *Universe) Run() {
 			case msg := <-u.setSignalChan:
 				s := &u.signalSet[-msg.index]
 				s.value = msg.val
-				for _, v := range s.child {
+				for v := range s.child.All() {
 					u.computerSet[v].renovate = false
 				}
 				if s.effect != nil {
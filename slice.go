@@ -2,10 +2,14 @@ package utils
 
 import (
 	"cmp"
+	"iter"
 	"slices"
 )
 
-// RemoveDuplicates 排序去重
+// 长度不超过该值时，去重采用线性查找代替map，避免分配
+const uniqueLinearThreshold = 16
+
+// RemoveDuplicates 排序去重，原地修改s并复用其底层数组
 func RemoveDuplicates[T cmp.Ordered](s []T) []T {
 	if len(s) == 0 {
 		return nil
@@ -25,11 +29,28 @@ func RemoveDuplicates[T cmp.Ordered](s []T) []T {
 	return s[:k+1]
 }
 
-// UniqueWithoutSort 去重但不排序
+// RemoveDuplicatesClone 排序去重，不修改s，返回新切片
+func RemoveDuplicatesClone[T cmp.Ordered](s []T) []T {
+	if len(s) == 0 {
+		return nil
+	}
+	return RemoveDuplicates(slices.Clone(s))
+}
+
+// UniqueWithoutSort 去重但不排序，保持首次出现的顺序，不修改s，返回新切片
 func UniqueWithoutSort[T comparable](s []T) []T {
 	if len(s) == 0 {
 		return nil
 	}
+	if len(s) <= uniqueLinearThreshold {
+		result := make([]T, 0, len(s))
+		for _, value := range s {
+			if !slices.Contains(result, value) {
+				result = append(result, value)
+			}
+		}
+		return result
+	}
 	// 使用map来记录元素是否已经出现过
 	seen := make(map[T]bool)
 	var result []T
@@ -43,4 +64,273 @@ func UniqueWithoutSort[T comparable](s []T) []T {
 	return result
 }
 
+// UniqueInPlace 去重但不排序，保持首次出现的顺序，原地修改s并复用其底层数组
+func UniqueInPlace[T comparable](s []T) []T {
+	if len(s) == 0 {
+		return nil
+	}
+	k := 0
+	if len(s) <= uniqueLinearThreshold {
+		for _, value := range s {
+			if !slices.Contains(s[:k], value) {
+				s[k] = value
+				k++
+			}
+		}
+	} else {
+		seen := make(map[T]struct{}, len(s))
+		for _, value := range s {
+			if _, ok := seen[value]; !ok {
+				seen[value] = struct{}{}
+				s[k] = value
+				k++
+			}
+		}
+	}
+	// 清理尾部，便于GC回收
+	clear(s[k:])
+	return s[:k]
+}
+
+// UniqueBy 按key去重，保持首次出现的顺序，不修改s，返回新切片
+func UniqueBy[T any, K comparable](s []T, key func(T) K) []T {
+	if len(s) == 0 {
+		return nil
+	}
+	result := make([]T, 0, len(s))
+	if len(s) <= uniqueLinearThreshold {
+		var buf [uniqueLinearThreshold]K
+		keys := buf[:0]
+		for _, value := range s {
+			k := key(value)
+			if !slices.Contains(keys, k) {
+				keys = append(keys, k)
+				result = append(result, value)
+			}
+		}
+		return result
+	}
+	seen := make(map[K]struct{}, len(s))
+	for _, value := range s {
+		k := key(value)
+		if _, ok := seen[k]; !ok {
+			seen[k] = struct{}{}
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// Pair 二元组
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+// Map 映射，对每个元素调用f，返回结果切片
+func Map[T, R any](s []T, f func(T) R) []R {
+	if s == nil {
+		return nil
+	}
+	result := make([]R, len(s))
+	for i, v := range s {
+		result[i] = f(v)
+	}
+	return result
+}
+
+// Filter 过滤，返回f为true的元素组成的新切片
+func Filter[T any](s []T, f func(T) bool) []T {
+	var result []T
+	for _, v := range s {
+		if f(v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// Reduce 归约，从initial开始依次累积
+func Reduce[T, R any](s []T, f func(R, T) R, initial R) R {
+	result := initial
+	for _, v := range s {
+		result = f(result, v)
+	}
+	return result
+}
+
+// GroupBy 按key分组，组内保持原有顺序
+func GroupBy[T any, K comparable](s []T, key func(T) K) map[K][]T {
+	result := make(map[K][]T)
+	for _, v := range s {
+		k := key(v)
+		result[k] = append(result[k], v)
+	}
+	return result
+}
+
+// Partition 按f拆分为两部分，yes为f为true的元素，no为其余元素
+func Partition[T any](s []T, f func(T) bool) (yes, no []T) {
+	for _, v := range s {
+		if f(v) {
+			yes = append(yes, v)
+		} else {
+			no = append(no, v)
+		}
+	}
+	return
+}
+
+// Chunk 按size分块，最后一块可能不足size，各块与s共享底层数组
+func Chunk[T any](s []T, size int) [][]T {
+	if size < 1 {
+		panic("Chunk: size必须大于0")
+	}
+	if len(s) == 0 {
+		return nil
+	}
+	result := make([][]T, 0, (len(s)+size-1)/size)
+	for i := 0; i < len(s); i += size {
+		end := min(i+size, len(s))
+		result = append(result, s[i:end:end])
+	}
+	return result
+}
+
+// KeyBy 按key建立索引，key重复时后者覆盖前者
+func KeyBy[T any, K comparable](s []T, key func(T) K) map[K]T {
+	result := make(map[K]T, len(s))
+	for _, v := range s {
+		result[key(v)] = v
+	}
+	return result
+}
+
+// Zip 按位置组合两个切片，长度取较短者
+func Zip[A, B any](a []A, b []B) []Pair[A, B] {
+	n := min(len(a), len(b))
+	if n == 0 {
+		return nil
+	}
+	result := make([]Pair[A, B], n)
+	for i := range n {
+		result[i] = Pair[A, B]{First: a[i], Second: b[i]}
+	}
+	return result
+}
+
+// Difference 差集，返回在a中但不在b中的元素，保持a的顺序
+func Difference[T comparable](a, b []T) []T {
+	seen := make(map[T]struct{}, len(b))
+	for _, v := range b {
+		seen[v] = struct{}{}
+	}
+	var result []T
+	for _, v := range a {
+		if _, ok := seen[v]; !ok {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// Intersect 交集，返回同时在a和b中的元素，去重并保持a的顺序
+func Intersect[T comparable](a, b []T) []T {
+	seen := make(map[T]bool, len(b))
+	for _, v := range b {
+		seen[v] = false
+	}
+	var result []T
+	for _, v := range a {
+		// false 表示在b中且尚未加入结果
+		if added, ok := seen[v]; ok && !added {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// Union 并集，去重并保持先a后b的顺序
+func Union[T comparable](a, b []T) []T {
+	seen := make(map[T]struct{}, len(a)+len(b))
+	var result []T
+	for _, s := range [][]T{a, b} {
+		for _, v := range s {
+			if _, ok := seen[v]; !ok {
+				seen[v] = struct{}{}
+				result = append(result, v)
+			}
+		}
+	}
+	return result
+}
+
+// MapSeq 惰性映射
+func MapSeq[T, R any](seq iter.Seq[T], f func(T) R) iter.Seq[R] {
+	return func(yield func(R) bool) {
+		for v := range seq {
+			if !yield(f(v)) {
+				return
+			}
+		}
+	}
+}
+
+// FilterSeq 惰性过滤
+func FilterSeq[T any](seq iter.Seq[T], f func(T) bool) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for v := range seq {
+			if f(v) && !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// ReduceSeq 归约迭代器
+func ReduceSeq[T, R any](seq iter.Seq[T], f func(R, T) R, initial R) R {
+	result := initial
+	for v := range seq {
+		result = f(result, v)
+	}
+	return result
+}
+
+// ChunkSeq 惰性分块，每块为新分配的切片
+func ChunkSeq[T any](seq iter.Seq[T], size int) iter.Seq[[]T] {
+	if size < 1 {
+		panic("ChunkSeq: size必须大于0")
+	}
+	return func(yield func([]T) bool) {
+		buf := make([]T, 0, size)
+		for v := range seq {
+			buf = append(buf, v)
+			if len(buf) == size {
+				if !yield(buf) {
+					return
+				}
+				buf = make([]T, 0, size)
+			}
+		}
+		if len(buf) > 0 {
+			yield(buf)
+		}
+	}
+}
+
+// ZipSeq 惰性组合两个迭代器，任一结束即停止
+func ZipSeq[A, B any](a iter.Seq[A], b iter.Seq[B]) iter.Seq2[A, B] {
+	return func(yield func(A, B) bool) {
+		next, stop := iter.Pull(b)
+		defer stop()
+		for va := range a {
+			vb, ok := next()
+			if !ok || !yield(va, vb) {
+				return
+			}
+		}
+	}
+}
+
 // https://github.com/samber/lo
@@ -2,6 +2,8 @@ package utils
 
 import (
 	"reflect"
+	"slices"
+	"strconv"
 	"testing"
 )
 
@@ -36,3 +38,221 @@ func TestUniqueWithoutSort(t *testing.T) {
 		}
 	}
 }
+
+func TestRemoveDuplicatesClone(t *testing.T) {
+	arg := []int{8, 2, 7, 3, 5, 3, 4, 5}
+	r := RemoveDuplicatesClone(arg)
+	if !reflect.DeepEqual(r, []int{2, 3, 4, 5, 7, 8}) {
+		t.Fatal(r)
+	}
+	if !reflect.DeepEqual(arg, []int{8, 2, 7, 3, 5, 3, 4, 5}) {
+		t.Fatal(arg)
+	}
+}
+
+func TestUniqueInPlace(t *testing.T) {
+	large := make([]int, 100)
+	for i := range large {
+		large[i] = i % 30
+	}
+	var tests = []struct {
+		arg    []int
+		result []int
+	}{
+		{[]int{8, 2, 7, 3, 5, 3, 4, 5}, []int{8, 2, 7, 3, 5, 4}},
+		{[]int{0, 1, 3, 4, 6, 7, 8, 0}, []int{0, 1, 3, 4, 6, 7, 8}},
+		{large, large[:30]},
+	}
+	for i := range tests {
+		want := slices.Clone(tests[i].result)
+		if r := UniqueWithoutSort(tests[i].arg); !reflect.DeepEqual(r, want) {
+			t.Fatal(i, r, want)
+		}
+		if r := UniqueInPlace(tests[i].arg); !reflect.DeepEqual(r, want) {
+			t.Fatal(i, r, want)
+		}
+	}
+}
+
+func TestUniqueBy(t *testing.T) {
+	type user struct {
+		id   int
+		name string
+	}
+	small := []user{{1, "a"}, {2, "b"}, {1, "c"}, {3, "d"}, {2, "e"}}
+	r := UniqueBy(small, func(u user) int { return u.id })
+	if !reflect.DeepEqual(r, []user{{1, "a"}, {2, "b"}, {3, "d"}}) {
+		t.Fatal(r)
+	}
+	var large []user
+	for i := range 100 {
+		large = append(large, user{i % 20, strconv.Itoa(i)})
+	}
+	r = UniqueBy(large, func(u user) int { return u.id })
+	if !reflect.DeepEqual(r, large[:20]) {
+		t.Fatal(r)
+	}
+}
+
+func benchmarkUniqueData(n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = i % (n/2 + 1)
+	}
+	return s
+}
+
+func BenchmarkUniqueWithoutSort8(b *testing.B) {
+	s := benchmarkUniqueData(8)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = UniqueWithoutSort(s)
+	}
+}
+
+func BenchmarkUniqueWithoutSort1024(b *testing.B) {
+	s := benchmarkUniqueData(1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = UniqueWithoutSort(s)
+	}
+}
+
+func BenchmarkUniqueInPlace8(b *testing.B) {
+	s := benchmarkUniqueData(8)
+	buf := make([]int, len(s))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		copy(buf, s)
+		_ = UniqueInPlace(buf)
+	}
+}
+
+func BenchmarkUniqueInPlace1024(b *testing.B) {
+	s := benchmarkUniqueData(1024)
+	buf := make([]int, len(s))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		copy(buf, s)
+		_ = UniqueInPlace(buf)
+	}
+}
+
+func BenchmarkUniqueBy8(b *testing.B) {
+	s := benchmarkUniqueData(8)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = UniqueBy(s, func(v int) int { return v })
+	}
+}
+
+func BenchmarkRemoveDuplicatesClone1024(b *testing.B) {
+	s := benchmarkUniqueData(1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = RemoveDuplicatesClone(s)
+	}
+}
+
+func TestMapFilterReduce(t *testing.T) {
+	s := []int{1, 2, 3, 4, 5, 6}
+	m := Map(s, strconv.Itoa)
+	if !reflect.DeepEqual(m, []string{"1", "2", "3", "4", "5", "6"}) {
+		t.Fatal(m)
+	}
+	f := Filter(s, func(v int) bool { return v%2 == 0 })
+	if !reflect.DeepEqual(f, []int{2, 4, 6}) {
+		t.Fatal(f)
+	}
+	r := Reduce(s, func(acc, v int) int { return acc + v }, 10)
+	if r != 31 {
+		t.Fatal(r)
+	}
+	yes, no := Partition(s, func(v int) bool { return v > 4 })
+	if !reflect.DeepEqual(yes, []int{5, 6}) || !reflect.DeepEqual(no, []int{1, 2, 3, 4}) {
+		t.Fatal(yes, no)
+	}
+}
+
+func TestGroupByKeyBy(t *testing.T) {
+	s := []string{"a", "bb", "cc", "ddd", "e"}
+	g := GroupBy(s, func(v string) int { return len(v) })
+	if !reflect.DeepEqual(g, map[int][]string{1: {"a", "e"}, 2: {"bb", "cc"}, 3: {"ddd"}}) {
+		t.Fatal(g)
+	}
+	k := KeyBy(s, func(v string) int { return len(v) })
+	if !reflect.DeepEqual(k, map[int]string{1: "e", 2: "cc", 3: "ddd"}) {
+		t.Fatal(k)
+	}
+}
+
+func TestChunk(t *testing.T) {
+	var tests = []struct {
+		arg    []int
+		size   int
+		result [][]int
+	}{
+		{[]int{1, 2, 3, 4, 5}, 2, [][]int{{1, 2}, {3, 4}, {5}}},
+		{[]int{1, 2, 3, 4}, 2, [][]int{{1, 2}, {3, 4}}},
+		{[]int{1, 2}, 5, [][]int{{1, 2}}},
+		{nil, 3, nil},
+	}
+	for i := range tests {
+		r := Chunk(tests[i].arg, tests[i].size)
+		if !reflect.DeepEqual(r, tests[i].result) {
+			t.Fatal(i, r, tests[i].result)
+		}
+		c := slices.Collect(ChunkSeq(slices.Values(tests[i].arg), tests[i].size))
+		if !reflect.DeepEqual(c, tests[i].result) {
+			t.Fatal(i, c, tests[i].result)
+		}
+	}
+}
+
+func TestZip(t *testing.T) {
+	z := Zip([]int{1, 2, 3}, []string{"a", "b"})
+	if !reflect.DeepEqual(z, []Pair[int, string]{{1, "a"}, {2, "b"}}) {
+		t.Fatal(z)
+	}
+	var a []int
+	var b []string
+	for x, y := range ZipSeq(slices.Values([]int{1, 2, 3}), slices.Values([]string{"a", "b"})) {
+		a = append(a, x)
+		b = append(b, y)
+	}
+	if !reflect.DeepEqual(a, []int{1, 2}) || !reflect.DeepEqual(b, []string{"a", "b"}) {
+		t.Fatal(a, b)
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	var tests = []struct {
+		a, b                         []int
+		difference, intersect, union []int
+	}{
+		{[]int{1, 2, 3, 2}, []int{2, 4}, []int{1, 3}, []int{2}, []int{1, 2, 3, 4}},
+		{[]int{1, 2}, nil, []int{1, 2}, nil, []int{1, 2}},
+		{nil, []int{5, 5}, nil, nil, []int{5}},
+	}
+	for i := range tests {
+		if r := Difference(tests[i].a, tests[i].b); !reflect.DeepEqual(r, tests[i].difference) {
+			t.Fatal(i, r, tests[i].difference)
+		}
+		if r := Intersect(tests[i].a, tests[i].b); !reflect.DeepEqual(r, tests[i].intersect) {
+			t.Fatal(i, r, tests[i].intersect)
+		}
+		if r := Union(tests[i].a, tests[i].b); !reflect.DeepEqual(r, tests[i].union) {
+			t.Fatal(i, r, tests[i].union)
+		}
+	}
+}
+
+func TestSeq(t *testing.T) {
+	seq := FilterSeq(MapSeq(slices.Values([]int{1, 2, 3, 4, 5}), func(v int) int { return v * v }), func(v int) bool { return v%2 == 1 })
+	if r := slices.Collect(seq); !reflect.DeepEqual(r, []int{1, 9, 25}) {
+		t.Fatal(r)
+	}
+	if r := ReduceSeq(seq, func(acc, v int) int { return acc + v }, 0); r != 35 {
+		t.Fatal(r)
+	}
+}
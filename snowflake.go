@@ -34,6 +34,8 @@ type SnowFlakeID struct {
 	//12bit的序列号
 	sequence int64
 	mutex    sync.Mutex
+	//时钟，nil 为系统时钟
+	clock Clock
 }
 
 // NewSnowFlakeID 工作组
@@ -43,7 +45,7 @@ func NewSnowFlakeID(id int64, startupTime int64) *SnowFlakeID {
 	}
 	s := &SnowFlakeID{
 		systemCenterStartupTime: startupTime / int64(time.Millisecond),
-		lastTimestamp:           timeGen(),
+		lastTimestamp:           timeGen(nil),
 		workID:                  id << WorkLeftShift,
 		sequence:                0,
 	}
@@ -52,7 +54,7 @@ func NewSnowFlakeID(id int64, startupTime int64) *SnowFlakeID {
 
 // NextID 取得 snowflake id.
 func (s *SnowFlakeID) NextID() (int64, error) {
-	timestamp := timeGen()
+	timestamp := timeGen(s.clock)
 	s.mutex.Lock()
 	if timestamp < s.lastTimestamp {
 		s.mutex.Unlock()
@@ -75,9 +77,18 @@ func (s *SnowFlakeID) NextID() (int64, error) {
 	return id, nil
 }
 
-// timeGen 取得time.Now() unix 毫秒.
-func timeGen() int64 {
-	return time.Now().UnixNano() / int64(time.Millisecond)
+// SetClock 设置时钟，须在使用前设置
+func (s *SnowFlakeID) SetClock(c Clock) *SnowFlakeID {
+	s.mutex.Lock()
+	s.clock = c
+	s.lastTimestamp = timeGen(c)
+	s.mutex.Unlock()
+	return s
+}
+
+// timeGen 取得时钟c的 unix 毫秒.
+func timeGen(c Clock) int64 {
+	return clockOr(c).Now().UnixNano() / int64(time.Millisecond)
 }
 
 // GetWorkID 取得工作机器id
@@ -156,3 +156,17 @@ func TestGetWorkID(t *testing.T) {
 		t.Error("失败:", n3, GetWorkID(n3))
 	}
 }
+
+func TestSnowFlakeIDFakeClock(t *testing.T) {
+	start := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start.Add(time.Second))
+	s := NewSnowFlakeID(1, start.UnixNano()).SetClock(clock)
+	id, err := s.NextID()
+	if err != nil || id != 1000<<TimestampLeftShift|1<<WorkLeftShift|1 {
+		t.Fatal(id, err)
+	}
+	clock.Advance(-time.Millisecond)
+	if _, err := s.NextID(); err != ErrMachineTimeUnSynchronize {
+		t.Fatal(err)
+	}
+}
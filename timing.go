@@ -11,50 +11,36 @@ import (
 type task struct {
 	// 下次执行时间,元素在队列中的优先级
 	next time.Time
-	// 元素在堆中的索引
-	index int
 	//返回下次执行间隔时间,0 退出
 	do func() time.Duration
 }
 
-type priorityQueue []task
-
-func (p priorityQueue) Len() int           { return len(p) }
-func (p priorityQueue) Less(i, j int) bool { return p[i].next.Before(p[j].next) }
-func (p priorityQueue) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
-func (p *priorityQueue) Push(x any) {
-	n := len(*p)
-	item := x.(task)
-	item.index = n
-	*p = append(*p, item)
-}
-func (p *priorityQueue) Pop() any {
-	old := *p
-	n := len(old)
-	item := old[n-1]
-	// 为了安全性考虑而做的设置
-	item.index = -1
-	*p = old[0 : n-1]
-	return item
-}
+// taskBefore 按执行时间排序
+func taskBefore(a, b task) bool { return a.next.Before(b.next) }
 
 type Timing struct {
 	panicHandler func(error)
-	queue        priorityQueue
-	AddTaskChan  chan task
+	queue        heapSlice[task]
+	addQueue     *MPSCQueue[task]
 	closeOnce    sync.Once
 	stopChan     chan struct{}
+	clock        Clock
 }
 
 // NewTiming 新建
 func NewTiming(p func(error)) *Timing {
+	return NewTimingWithClock(p, nil)
+}
+
+// NewTimingWithClock 使用时钟c新建，c为nil时为系统时钟
+func NewTimingWithClock(p func(error), c Clock) *Timing {
 	var t = Timing{
 		panicHandler: p,
-		queue:        make(priorityQueue, 0, 128),
-		AddTaskChan:  make(chan task, 128),
+		clock:        clockOr(c),
+		queue:        heapSlice[task]{items: make([]task, 0, 128), less: taskBefore},
+		addQueue:     NewMPSCQueue[task](),
 		stopChan:     make(chan struct{}),
 	}
-	heap.Init(&t.queue)
 	go t.run()
 	return &t
 }
@@ -67,7 +53,7 @@ func (t *Timing) Stop() {
 
 }
 
-// AddTask 加入任务
+// AddTask 加入任务，不阻塞
 func (t *Timing) AddTask(next time.Time, f func() time.Duration) error {
 	warp := func(base func() time.Duration) func() time.Duration {
 		defer func() {
@@ -81,38 +67,41 @@ func (t *Timing) AddTask(next time.Time, f func() time.Duration) error {
 	select {
 	case <-t.stopChan:
 		return errors.New("Timing closed")
-	case t.AddTaskChan <- task{next: next, do: warp(f)}:
 	default:
-		return errors.New("join failed")
 	}
+	t.addQueue.Push(task{next: next, do: warp(f)})
 	return nil
 }
 
 func (t *Timing) run() {
-	timer := time.NewTimer(time.Second)
+	timer := t.clock.NewTimer(time.Second)
 	defer timer.Stop()
 	var interval time.Duration = 64 * 365 * 24 * time.Hour
 	for {
 		select {
-		case v := <-t.AddTaskChan:
-			heap.Push(&t.queue, v)
-			new := time.Until(v.next)
-			if new < interval {
-				interval = new
-				timer.Reset(interval)
+		case <-t.addQueue.Notify():
+			for {
+				v, ok := t.addQueue.Pop()
+				if !ok {
+					break
+				}
+				heap.Push(&t.queue, v)
+				new := v.next.Sub(t.clock.Now())
+				if new < interval {
+					interval = new
+					timer.Reset(interval)
+				}
 			}
-		case <-timer.C:
-			if len(t.queue) > 0 {
+		case <-timer.C():
+			if t.queue.Len() > 0 {
 				v1 := heap.Pop(&t.queue).(task)
 				space := v1.do()
 				if space > 0 {
-					v1.next = time.Now().Add(space)
+					v1.next = t.clock.Now().Add(space)
 					heap.Push(&t.queue, v1)
 				}
-				if len(t.queue) > 0 {
-					v2 := heap.Pop(&t.queue).(task)
-					interval = time.Until(v2.next)
-					heap.Push(&t.queue, v2)
+				if t.queue.Len() > 0 {
+					interval = t.queue.items[0].next.Sub(t.clock.Now())
 					timer.Reset(interval)
 				} else {
 					interval = 64 * 365 * 24 * time.Hour
@@ -3,6 +3,7 @@ package utils
 import (
 	"container/heap"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -15,12 +16,9 @@ func TestPriorityQueue(t *testing.T) {
 		"3": {next: now.Add(3 * space)}, "2": {next: now.Add(2 * space)}, "4": {next: now.Add(4 * space)},
 	}
 	// 创建一个优先队列，并将上述元素放入到队列里面
-	pq := make(priorityQueue, len(items))
-	i := 0
+	pq := heapSlice[task]{less: taskBefore}
 	for _, priority := range items {
-		pq[i] = priority
-		pq[i].index = i
-		i++
+		pq.items = append(pq.items, priority)
 	}
 	heap.Init(&pq)
 	// 插入新元素，然后修改它的优先级
@@ -79,3 +77,43 @@ aa 2024-05-27 20:02:18.79801 +0800 CST m=+2.493538301
 cc 2024-05-27 20:02:18.8595002 +0800 CST m=+2.555028501
 aa 2024-05-27 20:02:19.1065649 +0800 CST m=+2.802093201
 */
+
+func TestTimingAddTaskBurst(t *testing.T) {
+	tr := NewTiming(nil)
+	defer tr.Stop()
+	var count int64
+	n := time.Now()
+	for i := range 1000 {
+		err := tr.AddTask(n.Add(time.Duration(i%10)*time.Millisecond), func() time.Duration {
+			atomic.AddInt64(&count, 1)
+			return 0
+		})
+		if err != nil {
+			t.Fatal(i, err)
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+	if atomic.LoadInt64(&count) != 1000 {
+		t.Fatal(count)
+	}
+}
+
+func TestTimingFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	tr := NewTimingWithClock(nil, clock)
+	defer tr.Stop()
+	var count int64
+	tr.AddTask(clock.Now().Add(time.Minute), func() time.Duration {
+		atomic.AddInt64(&count, 1)
+		return time.Minute
+	})
+	//等待任务入队
+	time.Sleep(10 * time.Millisecond)
+	for i := range 3 {
+		clock.Advance(30 * time.Second)
+		time.Sleep(10 * time.Millisecond)
+		if c := atomic.LoadInt64(&count); c != int64(i+1)/2 {
+			t.Fatal(i, c)
+		}
+	}
+}